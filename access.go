@@ -0,0 +1,119 @@
+package osm2ch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+const (
+	defaultDestinationPenalty = 2.0
+)
+
+// accessLevel Result of evaluation of access tags
+type accessLevel uint16
+
+const (
+	accessAllowed = accessLevel(iota)
+	// Access is allowed for reaching some destination only (e.g. 'access=destination' / 'access=delivery')
+	accessDestination
+	accessDenied
+)
+
+// DestinationPolicy Defines how ways with 'destination' or 'delivery' access should be treated
+type DestinationPolicy uint16
+
+const (
+	// Include ways into graph, but increase travel time along them
+	DestinationPenalize = DestinationPolicy(iota)
+	// Do not include ways into graph
+	DestinationExclude
+)
+
+// ParseDestinationPolicy Returns policy for given name. Supported names are: 'penalty', 'exclude'
+func ParseDestinationPolicy(name string) (DestinationPolicy, error) {
+	switch strings.ToLower(name) {
+	case "penalty", "penalize", "":
+		return DestinationPenalize, nil
+	case "exclude":
+		return DestinationExclude, nil
+	default:
+		return DestinationPenalize, fmt.Errorf("Unknown policy for destination access: '%s'", name)
+	}
+}
+
+// accessHierarchy Keys of access tags for each type of transport: from the most generic key to the most specific one
+// See the ref.: https://wiki.openstreetmap.org/wiki/Key:access#Transport_mode_restrictions
+var accessHierarchy = map[TransportMode][]string{
+	TransportModeCar:     []string{"access", "vehicle", "motor_vehicle", "motorcar"},
+	TransportModeBicycle: []string{"access", "vehicle", "bicycle"},
+	TransportModeFoot:    []string{"access", "foot"},
+	TransportModeHGV:     []string{"access", "vehicle", "motor_vehicle", "hgv"},
+}
+
+// parseAccess Returns access level for value of access tag. Returns false if value is missing or unknown
+func parseAccess(value string) (accessLevel, bool) {
+	switch value {
+	case "yes", "permissive", "designated", "official", "discouraged", "permit":
+		return accessAllowed, true
+	case "destination", "delivery", "customers":
+		return accessDestination, true
+	case "no", "private", "agricultural", "forestry", "emergency", "military", "use_sidepath":
+		return accessDenied, true
+	default:
+		return accessAllowed, false
+	}
+}
+
+// evaluateAccess Returns access level of way (or node) with given tags for given type of transport
+/*
+	The most specific known value wins. E.g. for 'access=no' + 'motor_vehicle=destination' cars get destination access.
+	Emergency roads ('service=emergency_access') are denied for motor vehicles and roads
+	for motor vehicles only ('motorroad=yes') are denied for bicycles and pedestrians
+*/
+func evaluateAccess(tags osm.Tags, mode TransportMode) accessLevel {
+	if level, ok := explicitAccess(tags, mode); ok {
+		return level
+	}
+	switch mode {
+	case TransportModeCar, TransportModeHGV:
+		if tags.Find("service") == "emergency_access" {
+			return accessDenied
+		}
+	case TransportModeBicycle, TransportModeFoot:
+		if tags.Find("motorroad") == "yes" {
+			return accessDenied
+		}
+	}
+	return accessAllowed
+}
+
+// explicitAccess Returns access level given by the most specific known access tag for given type of transport. Returns false if there are no such tags
+func explicitAccess(tags osm.Tags, mode TransportMode) (accessLevel, bool) {
+	keys := accessHierarchy[mode]
+	for i := len(keys) - 1; i >= 0; i-- {
+		if level, ok := parseAccess(tags.Find(keys[i])); ok {
+			return level, true
+		}
+	}
+	return accessAllowed, false
+}
+
+// wayAccess Returns multiplier for travel time along the way with given tags according to access tags. Returns false if way should not be included into graph
+func (cfg *OsmConfiguration) wayAccess(tags osm.Tags, mode TransportMode) (float64, bool) {
+	switch evaluateAccess(tags, mode) {
+	case accessDenied:
+		return 0, false
+	case accessDestination:
+		if cfg.DestinationAccess == DestinationExclude {
+			return 0, false
+		}
+		if cfg.DestinationPenalty > 0 {
+			return cfg.DestinationPenalty, true
+		}
+		return defaultDestinationPenalty, true
+	default:
+		return 1.0, true
+	}
+}
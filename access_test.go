@@ -0,0 +1,41 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestEvaluateAccess(t *testing.T) {
+	cases := []struct {
+		tags  osm.Tags
+		mode  TransportMode
+		level accessLevel
+	}{
+		{osm.Tags{{Key: "highway", Value: "residential"}}, TransportModeCar, accessAllowed},
+		{osm.Tags{{Key: "access", Value: "no"}}, TransportModeCar, accessDenied},
+		{osm.Tags{{Key: "access", Value: "no"}, {Key: "motor_vehicle", Value: "destination"}}, TransportModeCar, accessDestination},
+		{osm.Tags{{Key: "access", Value: "no"}, {Key: "motor_vehicle", Value: "destination"}}, TransportModeBicycle, accessDenied},
+		{osm.Tags{{Key: "motor_vehicle", Value: "private"}}, TransportModeCar, accessDenied},
+		{osm.Tags{{Key: "motor_vehicle", Value: "private"}}, TransportModeBicycle, accessAllowed},
+		{osm.Tags{{Key: "vehicle", Value: "no"}, {Key: "bicycle", Value: "yes"}}, TransportModeBicycle, accessAllowed},
+		{osm.Tags{{Key: "vehicle", Value: "no"}}, TransportModeFoot, accessAllowed},
+		{osm.Tags{{Key: "access", Value: "delivery"}}, TransportModeCar, accessDestination},
+		{osm.Tags{{Key: "service", Value: "emergency_access"}}, TransportModeCar, accessDenied},
+		{osm.Tags{{Key: "motorroad", Value: "yes"}}, TransportModeFoot, accessDenied},
+	}
+	for _, c := range cases {
+		level := evaluateAccess(c.tags, c.mode)
+		if level != c.level {
+			t.Errorf("Access level for tags %v and mode '%s' should be %d, but got %d", c.tags, c.mode, c.level, level)
+		}
+	}
+	cfg := OsmConfiguration{DestinationAccess: DestinationExclude}
+	if _, ok := cfg.wayAccess(osm.Tags{{Key: "access", Value: "destination"}}, TransportModeCar); ok {
+		t.Errorf("Way with destination access should be excluded")
+	}
+	cfg = OsmConfiguration{}
+	if penalty, ok := cfg.wayAccess(osm.Tags{{Key: "access", Value: "destination"}}, TransportModeCar); !ok || penalty != defaultDestinationPenalty {
+		t.Errorf("Way with destination access should be penalized by %f, but got %f", defaultDestinationPenalty, penalty)
+	}
+}
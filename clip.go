@@ -0,0 +1,432 @@
+package osm2ch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// ClipPolicy Defines how ways crossing boundary of clipping area should be treated
+type ClipPolicy uint16
+
+const (
+	// Keep whole way if at least one of its nodes is inside of area
+	ClipKeep = ClipPolicy(iota)
+	// Drop way if at least one of its nodes is outside of area
+	ClipDrop
+	// Cut way at boundary: keep only parts of way inside of area. Parts end at nodes which are created on boundary
+	ClipCut
+)
+
+// ParseClipPolicy Returns policy for given name. Supported names are: 'keep', 'drop', 'cut'
+func ParseClipPolicy(name string) (ClipPolicy, error) {
+	switch strings.ToLower(name) {
+	case "keep", "":
+		return ClipKeep, nil
+	case "drop":
+		return ClipDrop, nil
+	case "cut":
+		return ClipCut, nil
+	default:
+		return ClipKeep, fmt.Errorf("Unknown clip policy: '%s'", name)
+	}
+}
+
+// Area Region which road network should be clipped by
+type Area interface {
+	// Contains Checks if point is inside of area
+	Contains(pt GeoPoint) bool
+}
+
+// BBox Bounding box
+type BBox struct {
+	MinLon float64
+	MinLat float64
+	MaxLon float64
+	MaxLat float64
+}
+
+// Contains See the ref. at Area interface
+func (bbox BBox) Contains(pt GeoPoint) bool {
+	return pt.Lon >= bbox.MinLon && pt.Lon <= bbox.MaxLon && pt.Lat >= bbox.MinLat && pt.Lat <= bbox.MaxLat
+}
+
+// ParseBBox Parses bounding box from string in 'minLon,minLat,maxLon,maxLat' format
+func ParseBBox(value string) (BBox, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return BBox{}, fmt.Errorf("Bounding box should be in 'minLon,minLat,maxLon,maxLat' format, but got '%s'", value)
+	}
+	coords := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BBox{}, errors.Wrap(err, "Can't parse bounding box")
+		}
+		coords[i] = v
+	}
+	bbox := BBox{MinLon: coords[0], MinLat: coords[1], MaxLon: coords[2], MaxLat: coords[3]}
+	if bbox.MinLon > bbox.MaxLon || bbox.MinLat > bbox.MaxLat {
+		return BBox{}, fmt.Errorf("Minimum coordinates of bounding box should not be greater than maximum ones, but got '%s'", value)
+	}
+	return bbox, nil
+}
+
+// Polygon Area which is bounded by one or more outer rings and could have holes (inner rings)
+type Polygon struct {
+	Outer [][]GeoPoint
+	Inner [][]GeoPoint
+}
+
+// Contains See the ref. at Area interface
+func (polygon *Polygon) Contains(pt GeoPoint) bool {
+	for _, ring := range polygon.Inner {
+		if ringContains(ring, pt) {
+			return false
+		}
+	}
+	for _, ring := range polygon.Outer {
+		if ringContains(ring, pt) {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains Checks if point is inside of closed ring (ray casting algorithm, assuming points are Euclidean: Lon == X, Lat == Y)
+func ringContains(ring []GeoPoint, pt GeoPoint) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat > pt.Lat) != (b.Lat > pt.Lat) && pt.Lon < (b.Lon-a.Lon)*(pt.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// LoadPolygon Reads polygon from file. Supported formats are Osmosis polygon format (*.poly) and GeoJSON (Polygon or MultiPolygon geometry, Feature or FeatureCollection)
+func LoadPolygon(fileName string) (*Polygon, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't read polygon file")
+	}
+	if strings.ToLower(filepath.Ext(fileName)) == ".poly" {
+		return parsePoly(data)
+	}
+	return parseGeoJSONPolygon(data)
+}
+
+// parsePoly Parses polygon in Osmosis polygon format
+/*
+	See the ref.: https://wiki.openstreetmap.org/wiki/Osmosis/Polygon_Filter_File_Format
+	Names of sections which are starting with '!' are holes
+*/
+func parsePoly(data []byte) (*Polygon, error) {
+	polygon := &Polygon{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	nextLine := func() (string, bool) {
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" {
+				return line, true
+			}
+		}
+		return "", false
+	}
+	// The first line is name of polygon
+	if _, ok := nextLine(); !ok {
+		return nil, fmt.Errorf("Polygon file is empty")
+	}
+	for {
+		sectionName, ok := nextLine()
+		if !ok {
+			return nil, fmt.Errorf("Unexpected end of polygon file: missing 'END'")
+		}
+		if sectionName == "END" {
+			break
+		}
+		ring := []GeoPoint{}
+		for {
+			line, ok := nextLine()
+			if !ok {
+				return nil, fmt.Errorf("Unexpected end of polygon file: section '%s' is not closed", sectionName)
+			}
+			if line == "END" {
+				break
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("Bad coordinates on line %d of polygon file: '%s'", lineNum, line)
+			}
+			lon, errLon := strconv.ParseFloat(fields[0], 64)
+			lat, errLat := strconv.ParseFloat(fields[1], 64)
+			if errLon != nil || errLat != nil {
+				return nil, fmt.Errorf("Bad coordinates on line %d of polygon file: '%s'", lineNum, line)
+			}
+			ring = append(ring, GeoPoint{Lon: lon, Lat: lat})
+		}
+		if strings.HasPrefix(sectionName, "!") {
+			polygon.Inner = append(polygon.Inner, ring)
+		} else {
+			polygon.Outer = append(polygon.Outer, ring)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "Can't read polygon file")
+	}
+	if len(polygon.Outer) == 0 {
+		return nil, fmt.Errorf("Polygon file has no outer rings")
+	}
+	return polygon, nil
+}
+
+// geoJSONObject Subset of GeoJSON object fields which are needed for reading polygons
+type geoJSONObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJSONObject  `json:"geometry"`
+	Features    []geoJSONObject `json:"features"`
+}
+
+// parseGeoJSONPolygon Parses GeoJSON Polygon or MultiPolygon (as geometry, Feature or FeatureCollection). Every polygon of collection is added to the result
+func parseGeoJSONPolygon(data []byte) (*Polygon, error) {
+	obj := geoJSONObject{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, errors.Wrap(err, "Can't parse GeoJSON")
+	}
+	polygon := &Polygon{}
+	if err := polygon.addGeoJSON(obj); err != nil {
+		return nil, err
+	}
+	if len(polygon.Outer) == 0 {
+		return nil, fmt.Errorf("GeoJSON has no polygons")
+	}
+	return polygon, nil
+}
+
+// addGeoJSON Adds rings of GeoJSON object to polygon
+func (polygon *Polygon) addGeoJSON(obj geoJSONObject) error {
+	switch obj.Type {
+	case "FeatureCollection":
+		for _, feature := range obj.Features {
+			if err := polygon.addGeoJSON(feature); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if obj.Geometry != nil {
+			return polygon.addGeoJSON(*obj.Geometry)
+		}
+	case "Polygon":
+		rings := [][][]float64{}
+		if err := json.Unmarshal(obj.Coordinates, &rings); err != nil {
+			return errors.Wrap(err, "Can't parse coordinates of Polygon")
+		}
+		polygon.addRings(rings)
+	case "MultiPolygon":
+		polygons := [][][][]float64{}
+		if err := json.Unmarshal(obj.Coordinates, &polygons); err != nil {
+			return errors.Wrap(err, "Can't parse coordinates of MultiPolygon")
+		}
+		for _, rings := range polygons {
+			polygon.addRings(rings)
+		}
+	default:
+		return fmt.Errorf("Unsupported type of GeoJSON object: '%s'", obj.Type)
+	}
+	return nil
+}
+
+// addRings Adds rings of single GeoJSON polygon: the first ring is outer one, others are holes
+func (polygon *Polygon) addRings(rings [][][]float64) {
+	for i, coords := range rings {
+		ring := make([]GeoPoint, 0, len(coords))
+		for _, pt := range coords {
+			if len(pt) < 2 {
+				continue
+			}
+			ring = append(ring, GeoPoint{Lon: pt[0], Lat: pt[1]})
+		}
+		if i == 0 {
+			polygon.Outer = append(polygon.Outer, ring)
+		} else {
+			polygon.Inner = append(polygon.Inner, ring)
+		}
+	}
+}
+
+// clipWays Returns ways which are left after clipping by area with given policy and nodes which have been created on boundary of area.
+// Nodes which are missing in store are considered as outside ones
+/*
+	When way is cut then every its part gets ID of the original way, so ways with the same ID could be met several times in the result.
+	Part of way ends at the point where segment crosses boundary of area: new node is created there (see the ref. at boundaryNodeID).
+	Segments which have both nodes outside of area are dropped even if they pass through area. When node outside of area is missing
+	in store then crossing point can't be evaluated and part ends at the last node inside of area
+*/
+func clipWays(ways []Way, nodes NodeStore, area Area, policy ClipPolicy) ([]Way, map[osm.NodeID]GeoPoint) {
+	result := make([]Way, 0, len(ways))
+	boundaryNodes := make(map[osm.NodeID]GeoPoint)
+	for _, way := range ways {
+		points := make([]GeoPoint, len(way.Nodes))
+		found := make([]bool, len(way.Nodes))
+		flags := make([]bool, len(way.Nodes))
+		insideCount := 0
+		for i, node := range way.Nodes {
+			points[i], found[i] = nodes.Get(node.ID)
+			flags[i] = found[i] && area.Contains(points[i])
+			if flags[i] {
+				insideCount++
+			}
+		}
+		switch {
+		case insideCount == len(way.Nodes):
+			result = append(result, way)
+		case insideCount == 0:
+			continue
+		case policy == ClipKeep:
+			result = append(result, way)
+		case policy == ClipCut:
+			// crossing Returns node on boundary for segment between node inside of area and node outside of area
+			crossing := func(inside, outside int) (osm.WayNode, bool) {
+				if !found[outside] {
+					return osm.WayNode{}, false
+				}
+				pt := boundaryCrossing(area, points[inside], points[outside])
+				id := boundaryNodeID(way.Nodes[inside].ID, way.Nodes[outside].ID)
+				boundaryNodes[id] = pt
+				return osm.WayNode{ID: id, Lat: pt.Lat, Lon: pt.Lon}, true
+			}
+			part := osm.WayNodes{}
+			flush := func() {
+				if len(part) >= 2 {
+					clipped := way
+					clipped.Nodes = part
+					result = append(result, clipped)
+				}
+				part = osm.WayNodes{}
+			}
+			for i, node := range way.Nodes {
+				if !flags[i] {
+					if len(part) != 0 {
+						if boundaryNode, ok := crossing(i-1, i); ok {
+							part = append(part, boundaryNode)
+						}
+						flush()
+					}
+					continue
+				}
+				if len(part) == 0 && i > 0 {
+					if boundaryNode, ok := crossing(i, i-1); ok {
+						part = append(part, boundaryNode)
+					}
+				}
+				part = append(part, node)
+			}
+			flush()
+		}
+	}
+	return result, boundaryNodes
+}
+
+// boundaryNodeID Returns identifier of node which is created on boundary of clipping area for segment between given nodes
+/*
+	Identifiers are negative, so they don't clash with OSM nodes. Identifier doesn't depend on direction of segment
+	and on other ways, so it is the same for every build (stable identifiers of edges rely on that) and ways sharing
+	the segment share the boundary node too
+*/
+func boundaryNodeID(a, b osm.NodeID) osm.NodeID {
+	if a > b {
+		a, b = b, a
+	}
+	hash := fnv.New64a()
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf[:8], uint64(a))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(b))
+	hash.Write(buf)
+	return -osm.NodeID(hash.Sum64()>>2) - 1
+}
+
+// ringsArea Area which is bounded by rings, so crossing points with its boundary could be evaluated exactly
+type ringsArea interface {
+	rings() [][]GeoPoint
+}
+
+// rings See the ref. at ringsArea interface
+func (bbox BBox) rings() [][]GeoPoint {
+	return [][]GeoPoint{{
+		{Lon: bbox.MinLon, Lat: bbox.MinLat},
+		{Lon: bbox.MaxLon, Lat: bbox.MinLat},
+		{Lon: bbox.MaxLon, Lat: bbox.MaxLat},
+		{Lon: bbox.MinLon, Lat: bbox.MaxLat},
+	}}
+}
+
+// rings See the ref. at ringsArea interface
+func (polygon *Polygon) rings() [][]GeoPoint {
+	rings := make([][]GeoPoint, 0, len(polygon.Outer)+len(polygon.Inner))
+	rings = append(rings, polygon.Outer...)
+	return append(rings, polygon.Inner...)
+}
+
+// boundaryCrossing Returns the first point (counting from inside point) where segment crosses boundary of area
+/*
+	Points are considered as Euclidean (Lon == X, Lat == Y), the same as for checking if point is inside of polygon.
+	For areas which are not bounded by rings (custom implementations of Area) crossing point is found by bisection
+*/
+func boundaryCrossing(area Area, inside, outside GeoPoint) GeoPoint {
+	if bounded, ok := area.(ringsArea); ok {
+		minT := math.Inf(1)
+		for _, ring := range bounded.rings() {
+			for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+				if t, ok := segmentsIntersection(inside, outside, ring[j], ring[i]); ok && t < minT {
+					minT = t
+				}
+			}
+		}
+		if !math.IsInf(minT, 1) {
+			return GeoPoint{Lon: inside.Lon + (outside.Lon-inside.Lon)*minT, Lat: inside.Lat + (outside.Lat-inside.Lat)*minT}
+		}
+	}
+	// Precision of bisection is about 1e-9 of segment length
+	for i := 0; i < 30; i++ {
+		middle := GeoPoint{Lon: (inside.Lon + outside.Lon) / 2, Lat: (inside.Lat + outside.Lat) / 2}
+		if area.Contains(middle) {
+			inside = middle
+		} else {
+			outside = middle
+		}
+	}
+	return inside
+}
+
+// segmentsIntersection Returns position (in range [0, 1]) of intersection point on the first segment (a-b) with the second one (c-d).
+// Returns false if segments don't intersect or they are parallel
+func segmentsIntersection(a, b, c, d GeoPoint) (float64, bool) {
+	rX, rY := b.Lon-a.Lon, b.Lat-a.Lat
+	sX, sY := d.Lon-c.Lon, d.Lat-c.Lat
+	denominator := rX*sY - rY*sX
+	if denominator == 0 {
+		return 0, false
+	}
+	qX, qY := c.Lon-a.Lon, c.Lat-a.Lat
+	t := (qX*sY - qY*sX) / denominator
+	u := (qX*rY - qY*rX) / denominator
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return 0, false
+	}
+	return t, true
+}
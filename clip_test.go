@@ -0,0 +1,138 @@
+package osm2ch
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestPolygonParsing(t *testing.T) {
+	poly := `square_with_hole
+1
+   0.0 0.0
+   10.0 0.0
+   10.0 10.0
+   0.0 10.0
+END
+!2
+   4.0 4.0
+   6.0 4.0
+   6.0 6.0
+   4.0 6.0
+END
+END
+`
+	geojson := `{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {}, "geometry": {"type": "Polygon", "coordinates": [
+		[[0, 0], [10, 0], [10, 10], [0, 10], [0, 0]],
+		[[4, 4], [6, 4], [6, 6], [4, 6], [4, 4]]
+	]}}]}`
+	fromPoly, err := parsePoly([]byte(poly))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fromGeoJSON, err := parseGeoJSONPolygon([]byte(geojson))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tests := []struct {
+		pt       GeoPoint
+		expected bool
+	}{
+		{GeoPoint{Lon: 1, Lat: 1}, true},
+		{GeoPoint{Lon: 5, Lat: 5}, false},
+		{GeoPoint{Lon: 11, Lat: 5}, false},
+		{GeoPoint{Lon: 9, Lat: 9.5}, true},
+	}
+	for _, polygon := range []*Polygon{fromPoly, fromGeoJSON} {
+		for _, test := range tests {
+			if polygon.Contains(test.pt) != test.expected {
+				t.Errorf("Point %v: expected %t", test.pt, test.expected)
+			}
+		}
+	}
+}
+
+func TestClipWays(t *testing.T) {
+	// Nodes 1, 2, 3 and 5 are inside, nodes 4 and 6 are outside
+	nodes := NewMapNodeStore()
+	for id, pt := range map[osm.NodeID]GeoPoint{
+		1: {Lon: 0, Lat: 0}, 2: {Lon: 1, Lat: 0}, 3: {Lon: 2, Lat: 1}, 4: {Lon: 4, Lat: 0}, 5: {Lon: 2, Lat: 0}, 6: {Lon: 4, Lat: 1},
+	} {
+		nodes.Put(id, pt)
+	}
+	nodes.Seal()
+	ways := []Way{
+		{ID: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+		{ID: 2, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 4}, {ID: 5}, {ID: 3}}},
+		{ID: 3, Nodes: osm.WayNodes{{ID: 4}, {ID: 4}}},
+		{ID: 4, Nodes: osm.WayNodes{{ID: 5}, {ID: 6}}},
+	}
+	bbox := BBox{MinLon: -1, MinLat: -1, MaxLon: 3, MaxLat: 2}
+	polygon := &Polygon{Outer: bbox.rings()}
+	for _, area := range []Area{bbox, polygon} {
+		if clipped, _ := clipWays(ways, nodes, area, ClipKeep); len(clipped) != 3 || len(clipped[1].Nodes) != 5 {
+			t.Errorf("Ways 1, 2 and 4 should be kept as is, but got %v", clipped)
+		}
+		if clipped, _ := clipWays(ways, nodes, area, ClipDrop); len(clipped) != 1 || clipped[0].ID != 1 {
+			t.Errorf("Only way 1 should be kept, but got %v", clipped)
+		}
+		clipped, boundaryNodes := clipWays(ways, nodes, area, ClipCut)
+		if len(clipped) != 4 {
+			t.Errorf("Way 2 should be cut into two parts and way 4 should be cut once, but got %v", clipped)
+			return
+		}
+		if clipped[1].ID != 2 || len(clipped[1].Nodes) != 3 || clipped[2].ID != 2 || len(clipped[2].Nodes) != 3 {
+			t.Errorf("Parts of way 2 should have 3 nodes each, but got %v and %v", clipped[1].Nodes, clipped[2].Nodes)
+			continue
+		}
+		// Parts end at nodes on boundary
+		tests := []struct {
+			node     osm.WayNode
+			expected GeoPoint
+		}{
+			{clipped[1].Nodes[2], GeoPoint{Lon: 3, Lat: 0}},
+			{clipped[2].Nodes[0], GeoPoint{Lon: 3, Lat: 0}},
+			{clipped[3].Nodes[1], GeoPoint{Lon: 3, Lat: 0.5}},
+		}
+		for _, test := range tests {
+			pt, ok := boundaryNodes[test.node.ID]
+			if !ok || test.node.ID >= 0 {
+				t.Errorf("Node %d should be created on boundary", test.node.ID)
+				continue
+			}
+			if Round(pt.Lon, 1e-9) != test.expected.Lon || Round(pt.Lat, 1e-9) != test.expected.Lat {
+				t.Errorf("Node %d should be at %v, but got %v", test.node.ID, test.expected, pt)
+			}
+		}
+	}
+	if boundaryNodeID(2, 4) != boundaryNodeID(4, 2) || boundaryNodeID(2, 4) == boundaryNodeID(4, 5) {
+		t.Errorf("Identifier of boundary node should depend on segment only")
+	}
+}
+
+func TestImportClipCut(t *testing.T) {
+	bbox := BBox{MinLon: -0.0005, MinLat: -0.0005, MaxLon: 0.0005, MaxLat: 0.0005}
+	graph, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{ClipArea: bbox, ClipPolicy: ClipCut})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(graph.Edges) != 8 {
+		t.Errorf("Every way should be cut by half, so 8 edges are expected, but got %d", len(graph.Edges))
+	}
+	onBoundary := func(pt GeoPoint) bool {
+		return math.Abs(math.Abs(pt.Lon)-0.0005) < 1e-9 || math.Abs(math.Abs(pt.Lat)-0.0005) < 1e-9
+	}
+	for _, edge := range graph.Edges {
+		boundaryNode, boundaryPt := edge.TargetNodeID, edge.Geom[len(edge.Geom)-1]
+		if edge.TargetNodeID == 1 {
+			boundaryNode, boundaryPt = edge.SourceNodeID, edge.Geom[0]
+		}
+		if boundaryNode >= 0 || !onBoundary(boundaryPt) {
+			t.Errorf("Edge %d should end on boundary at new node, but got node %d at %v", edge.ID, boundaryNode, boundaryPt)
+		}
+	}
+}
@@ -2,200 +2,764 @@ package main
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/LdDl/ch"
 	"github.com/LdDl/osm2ch"
+	"github.com/paulmach/osm"
 	"github.com/pkg/errors"
 )
 
 var (
-	tagStr        = flag.String("tags", "motorway,primary,primary_link,road,secondary,secondary_link,residential,tertiary,tertiary_link,unclassified,trunk,trunk_link,motorway_link", "Set of needed tags (separated by commas)")
-	osmFileName   = flag.String("file", "my_graph.osm.pbf", "Filename of *.osm.pbf file (it has to be compressed)")
-	out           = flag.String("out", "my_graph.csv", "Filename of 'Comma-Separated Values' (CSV) formatted file. E.g.: if file name is 'map.csv' then 3 files will be produced: 'map.csv' (edges), 'map_vertices.csv', 'map_shortcuts.csv'")
-	geomFormat    = flag.String("geomf", "wkt", "Format of output geometry. Expected values: wkt / geojson")
-	units         = flag.String("units", "km", "Units of output weights. Expected values: km for kilometers / m for meters")
-	doContraction = flag.Bool("contract", true, "Prepare contraction hierarchies?")
+	tagStr             = flag.String("tags", "", "Set of needed tags (separated by commas). If it is empty then every highway class supported by profile is used")
+	profileName        = flag.String("profile", "car", "Routing profile. Expected values: car / hgv / bicycle / foot")
+	profileFile        = flag.String("profile-file", "", "Filename of routing profile in JSON or YAML format. If it is provided then 'profile' flag is ignored")
+	destination        = flag.String("destination", "", "Treatment of roads with destination access ('access=destination', 'access=delivery' and etc.). Expected values: penalty / exclude. Default is 'penalty' (unless profile file says otherwise)")
+	destPenalty        = flag.Float64("destination-penalty", 0, "Multiplier for travel time along roads with destination access. Default is 2.0 (unless profile file says otherwise)")
+	referenceTime      = flag.String("at", "", "Moment of time for evaluating conditional tags ('restriction:conditional', 'access:conditional' and etc.) in local time of the region, e.g. '2021-03-01T08:30'. If it is empty then conditional tags are ignored")
+	out                = flag.String("out", "my_graph.csv", "Filename of 'Comma-Separated Values' (CSV) formatted file. E.g.: if file name is 'map.csv' then 4 files will be produced: 'map.csv' (edges), 'map_vertices.csv', 'map_shortcuts.csv', 'map_stats.json' (statistics of import)")
+	geomFormat         = flag.String("geomf", "wkt", "Format of output geometry. Expected values: wkt / geojson")
+	units              = flag.String("units", "km", "Units of output weights. Expected values: km for kilometers / m for meters")
+	weightType         = flag.String("weight", "distance", "Type of output weights. Expected values: distance (see 'units' flag) / time (seconds)")
+	doContraction      = flag.Bool("contract", true, "Prepare contraction hierarchies?")
+	bboxStr            = flag.String("bbox", "", "Bounding box for clipping of road network in 'minLon,minLat,maxLon,maxLat' format")
+	polyFile           = flag.String("poly", "", "Filename of polygon for clipping of road network: Osmosis polygon format (*.poly) or GeoJSON. If it is provided then 'bbox' flag is ignored")
+	clipPolicy         = flag.String("clip", "keep", "Treatment of ways crossing boundary of 'bbox' / 'poly'. Expected values: keep (keep whole way) / drop (drop way) / cut (cut way at boundary: new nodes with negative IDs are created there)")
+	nodeStore          = flag.String("node-store", "map", "Storage for coordinates of nodes. Expected values: map (fast, but memory consuming) / compact (sorted arrays in memory, 16 bytes per node) / mmap (sorted arrays in memory-mapped temporary file, for country-sized extracts)")
+	nodeStoreDir       = flag.String("node-store-dir", "", "Directory for temporary file of 'mmap' node store. Default is system temporary directory")
+	decoderProcs       = flag.Int("procs", 4, "Number of goroutines for decoding of PBF blocks")
+	workers            = flag.Int("workers", 0, "Number of goroutines for preparing and expanding edges. Default is number of CPUs. Output doesn't depend on it")
+	idPolicy           = flag.String("ids", "sequential", "Policy of generating identifiers of output vertices and edges. Expected values: sequential (order of OSM data) / stable (derived from OSM way and nodes, so they survive rebuilding with fresher extract)")
+	idMappingFile      = flag.String("id-mapping", "", "Filename of mapping of stable identifiers. It is read before import (if it exists) and written after import, so unchanged segments keep their identifiers between builds. Implies 'ids=stable'")
+	stateFile          = flag.String("state", "", "Filename of state of the build. Without 'changes' flag state is recorded during import, otherwise it is read, updated by change file and written back")
+	changesFile        = flag.String("changes", "", "Filename of OSM change file: *.osc or *.osc.gz. Changes are applied to state of previous build (see 'state' flag) instead of importing 'file'. Added, removed and changed edges are written to '<out>_changes.csv', ways which have been skipped because of missing nodes are written to '<out>_skipped_ways.csv'")
+	graphMode          = flag.String("mode", "expanded", "Type of output graph. Expected values: expanded (edges are vertices, turns are edges) / node (OSM nodes are vertices, restrictions and turn costs are not supported)")
+	quiet              = flag.Bool("quiet", false, "Don't write progress of import. Errors are written anyway")
+	verbose            = flag.Bool("verbose", false, "Write percentage of scanned OSM data in addition to stages of import")
+	restrictionsReport = flag.Bool("restrictions-report", false, "Write diagnostics of every restriction relation to '<out>_restrictions.csv': its members, outcome (applied or reason why it has been skipped) and identifiers of removed expanded edges")
+	logFormat          = flag.String("log-format", "text", "Format of progress of import which is written to stderr. Expected values: text / json (one object per line)")
 )
 
-func main() {
+// fileList Values of repeatable flag
+type fileList []string
 
-	flag.Parse()
+// String See the ref. at flag.Value interface
+func (files *fileList) String() string {
+	return strings.Join(*files, ",")
+}
+
+// Set See the ref. at flag.Value interface
+func (files *fileList) Set(value string) error {
+	*files = append(*files, value)
+	return nil
+}
 
-	tags := strings.Split(*tagStr, ",")
-	cfg := osm2ch.OsmConfiguration{
-		EntityName: "highway", // Currrently we do not support others
-		Tags:       tags,
+// expand Returns file names where glob patterns are replaced by matching files. Returns default value if list is empty
+func (files fileList) expand(defaultValue string) ([]string, error) {
+	if len(files) == 0 {
+		return []string{defaultValue}, nil
 	}
+	result := []string{}
+	for _, pattern := range files {
+		if !strings.ContainsAny(pattern, "*?[") {
+			result = append(result, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Bad pattern '%s'", pattern)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No files match pattern '%s'", pattern)
+		}
+		result = append(result, matches...)
+	}
+	return result, nil
+}
+
+var osmFileNames fileList
+
+// Exit codes of the command. Code 1 is used for unexpected failures and code 2 is used by flag package for malformed command line
+const (
+	// Bad values of flags, missing or unreadable input files (OSM data, profile, polygon, state, ID mapping)
+	exitInput = 3
+	// Malformed OSM data or OSM change file
+	exitParse = 4
+	// Graph can't be built from data (e.g. ways refer to missing nodes)
+	exitBuild = 5
+	// Contraction hierarchies can't be prepared
+	exitContraction = 6
+	// Output files (graph, state, ID mapping, reports) can't be written
+	exitOutput = 7
+)
+
+// commandError Failure of the command with its exit code
+type commandError struct {
+	code int
+	err  error
+}
+
+// Error See the ref. at error interface
+func (e *commandError) Error() string {
+	return e.err.Error()
+}
+
+// failure Adds context to error and assigns exit code to it
+func failure(code int, err error, message string) error {
+	return &commandError{code: code, err: errors.Wrap(err, message)}
+}
+
+// exitCode Returns exit code for error
+func exitCode(err error) int {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.code
+	}
+	return 1
+}
+
+// importExitCode Returns exit code for error of import: malformed data, unreadable input or failure of graph building
+func importExitCode(err error) int {
+	var parseErr *osm2ch.ParseError
+	if errors.As(err, &parseErr) {
+		return exitParse
+	}
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return exitInput
+	}
+	return exitBuild
+}
+
+func main() {
+	flag.Var(&osmFileNames, "file", "Filename of OSM file: *.osm.pbf, *.osm (XML) or *.osm.bz2 (bzip2 compressed XML). Format is detected by extension or by content of file.\nFlag could be repeated and glob patterns are supported (e.g. 'extracts/*.osm.pbf'): then files are merged into single graph, duplicated objects are resolved by version (default \"my_graph.osm.pbf\")")
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "osm2ch: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+}
 
-	edgeExpandedGraph, err := osm2ch.ImportFromOSMFile(*osmFileName, &cfg)
+// run Executes the command. Returned error carries exit code (see the ref. at exitCode)
+func run() error {
+	cfg, err := prepareConfiguration()
 	if err != nil {
-		fmt.Println(err)
-		return
+		return failure(exitInput, err, "Bad configuration")
 	}
 
 	fnamePart := strings.Split(*out, ".csv") // to guarantee proper filename and its extension
+	importedGraph, err := importGraph(cfg, fnamePart[0])
+	if err != nil {
+		return err
+	}
+	err = writeStats(fnamePart[0]+"_stats.json", &importedGraph.Stats)
+	if err != nil {
+		return failure(exitOutput, err, "Can't write statistics of import")
+	}
+	if *restrictionsReport {
+		err = writeRestrictionReports(fnamePart[0]+"_restrictions.csv", importedGraph.RestrictionReports)
+		if err != nil {
+			return failure(exitOutput, err, "Can't write diagnostics of restrictions")
+		}
+	}
+	var header []string
+	var outputEdges []outputEdge
+	if cfg.Mode == osm2ch.GraphModeNode {
+		header, outputEdges = prepareNodeBasedEdges(importedGraph.Edges)
+	} else {
+		header, outputEdges = prepareExpandedEdges(importedGraph.ExpandedEdges)
+	}
+
 	fnameEdges := fmt.Sprintf(fnamePart[0] + ".csv")
 	fnameVertices := fmt.Sprintf(fnamePart[0] + "_vertices.csv")
 	fnameShortcuts := fmt.Sprintf(fnamePart[0] + "_shortcuts.csv")
-	/* Edges file */
-	fileEdges, err := os.Create(fnameEdges)
+
+	graph, verticesGeoms, err := prepareCHGraph(outputEdges)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return failure(exitBuild, err, "Can't prepare graph for contraction hierarchies")
 	}
-	defer fileEdges.Close()
-	writerEdges := csv.NewWriter(fileEdges)
-	defer writerEdges.Flush()
-	writerEdges.Comma = ';'
-	// 		from_vertex_id - int64, ID of generated source vertex
-	// 		to_vertex_id - int64, ID of generated target vertex
-	// 		weight - float64, Weight of an edge (meters/kilometers)
-	//      geom - geometry (WKT or GeoJSON representation)
-	//      was_one_way - if edge was one way
-	//      edge_id - int64, ID of generated edge
-	// 		osm_way_from - int64, ID of source OSM Way
-	// 		osm_way_to - int64, ID of target OSM Way
-	// 		osm_way_from_source_node - int64, ID of first OSM Node in source OSM Way
-	// 		osm_way_from_target_node - int64, ID of last OSM Node in source OSM Way
-	// 		osm_way_to_source_node - int64, ID of first OSM Node in target OSM Way
-	// 		osm_way_to_target_node - int64, ID of last OSM Node in target OSM Way
-	err = writerEdges.Write([]string{"from_vertex_id", "to_vertex_id", "weight", "geom", "was_one_way", "edge_id", "osm_way_from", "osm_way_to", "osm_way_from_source_node", "osm_way_from_target_node", "osm_way_to_source_node", "osm_way_to_target_node"})
-	if err != nil {
-		fmt.Println(err)
-		return
+
+	if *doContraction {
+		finish := startStage(cfg.Logger, "contraction")
+		err = contract(graph)
+		if err != nil {
+			return failure(exitContraction, err, "Can't prepare contraction hierarchies")
+		}
+		finish(osm2ch.Counter{Name: "vertices", Value: len(graph.Vertices)})
 	}
 
-	/* Vertices file */
-	fileVertices, err := os.Create(fnameVertices)
+	finish := startStage(cfg.Logger, "output")
+	skippedEdges, err := writeEdges(fnameEdges, header, outputEdges)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return failure(exitOutput, err, "Can't write edges")
 	}
-	defer fileVertices.Close()
-	writerVertices := csv.NewWriter(fileVertices)
-	defer writerVertices.Flush()
-	writerVertices.Comma = ';'
-	// 		vertex_id - int64, ID of vertex
-	// 		order_pos - int, Position of vertex in hierarchies (evaluted by library)
-	// 		importance - int, Importance of vertex in graph (evaluted by library)
-	//      geom - geometry (WKT or GeoJSON representation)
-	err = writerVertices.Write([]string{"vertex_id", "order_pos", "importance", "geom"})
+	err = writeVertices(fnameVertices, graph, verticesGeoms, importedGraph.OriginalVertices)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return failure(exitOutput, err, "Can't write vertices")
 	}
 
-	verticesGeoms := make(map[int64]osm2ch.GeoPoint)
-	graph := ch.Graph{}
+	if *doContraction {
+		/* Write shortcuts */
+		// 	from_vertex_id - int64, ID of source vertex
+		// 	to_vertex_id - int64, ID of arget vertex
+		// 	weight - float64, Weight of an edge
+		// 	via_vertex_id - int64, ID of vertex through which the shortcut exists
+		err = graph.ExportShortcutsToFile(fnameShortcuts)
+		if err != nil {
+			return failure(exitOutput, err, "Can't write shortcuts")
+		}
+	}
+	// Skipped edges have no geometry
+	finish(
+		osm2ch.Counter{Name: "edges", Value: len(outputEdges) - skippedEdges},
+		osm2ch.Counter{Name: "skipped_edges", Value: skippedEdges},
+		osm2ch.Counter{Name: "vertices", Value: len(graph.Vertices)},
+	)
+	return nil
+}
 
-	// Prepare graph and write edges
-	for _, edge := range edgeExpandedGraph {
-		source := int64(edge.Source)
-		target := int64(edge.Target)
-		err := graph.CreateVertex(source)
+// startStage Reports start of stage of command to logger (if any). Returns function which reports finish of stage
+func startStage(logger osm2ch.Logger, stage string) func(counters ...osm2ch.Counter) {
+	if logger == nil {
+		return func(counters ...osm2ch.Counter) {}
+	}
+	logger.StageStarted(stage)
+	st := time.Now()
+	return func(counters ...osm2ch.Counter) {
+		logger.StageFinished(stage, time.Since(st), counters)
+	}
+}
+
+// prepareLogger Creates logger for progress of import. Returns nil in quiet mode
+func prepareLogger() (osm2ch.Logger, error) {
+	if *quiet && *verbose {
+		return nil, fmt.Errorf("Flags 'quiet' and 'verbose' can't be used together")
+	}
+	if *quiet {
+		return nil, nil
+	}
+	var logger osm2ch.Logger
+	switch strings.ToLower(*logFormat) {
+	case "text":
+		logger = osm2ch.NewTextLogger(os.Stderr, *verbose)
+	case "json":
+		logger = osm2ch.NewJSONLogger(os.Stderr, *verbose)
+	default:
+		return nil, fmt.Errorf("Unknown log format: '%s'", *logFormat)
+	}
+	return logger, nil
+}
+
+// prepareConfiguration Prepares configuration of import from flags
+func prepareConfiguration() (*osm2ch.OsmConfiguration, error) {
+	var cfg *osm2ch.OsmConfiguration
+	if *profileFile != "" {
+		var err error
+		cfg, err = osm2ch.LoadConfiguration(*profileFile)
 		if err != nil {
-			err = errors.Wrap(err, "Can not create source vertex")
-			return
+			return nil, err
 		}
-		err = graph.CreateVertex(target)
+	} else {
+		profile, err := osm2ch.ProfileByName(*profileName)
 		if err != nil {
-			err = errors.Wrap(err, "Can not create source vertex")
-			return
+			return nil, err
 		}
-		cost := edge.CostMeters
-		if strings.ToLower(*units) != "m" {
-			cost /= 1000.0
+		cfg = &osm2ch.OsmConfiguration{
+			EntityName: "highway", // Currrently we do not support others
+			Profile:    profile,
 		}
-		err = graph.AddEdge(source, target, cost)
+	}
+	if *tagStr != "" {
+		cfg.Tags = strings.Split(*tagStr, ",")
+	}
+	if *destination != "" {
+		policy, err := osm2ch.ParseDestinationPolicy(*destination)
 		if err != nil {
-			err = errors.Wrap(err, "Can not wrap Source and Targed vertices as Edge")
-			return
+			return nil, err
 		}
-		if len(edge.Geom) < 2 {
-			fmt.Println("!!")
-			// Skip bad expanded edges
-			continue
+		cfg.DestinationAccess = policy
+	}
+	if *destPenalty > 0 {
+		cfg.DestinationPenalty = *destPenalty
+	}
+	if *referenceTime != "" {
+		at, err := parseReferenceTime(*referenceTime)
+		if err != nil {
+			return nil, err
 		}
+		cfg.ReferenceTime = &at
+	}
+	// Output options are checked here too, so typos are reported before import
+	switch strings.ToLower(*weightType) {
+	case "distance", "time":
+	default:
+		return nil, fmt.Errorf("Unknown type of weights: '%s'", *weightType)
+	}
+	switch strings.ToLower(*units) {
+	case "km", "m":
+	default:
+		return nil, fmt.Errorf("Unknown units of weights: '%s'", *units)
+	}
 
-		geomStr := ""
-		if strings.ToLower(*geomFormat) == "geojson" {
-			geomStr = osm2ch.PrepareGeoJSONLinestring(edge.Geom)
-		} else {
-			geomStr = osm2ch.PrepareWKTLinestring(edge.Geom)
+	if *polyFile != "" {
+		polygon, err := osm2ch.LoadPolygon(*polyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClipArea = polygon
+	} else if *bboxStr != "" {
+		bbox, err := osm2ch.ParseBBox(*bboxStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClipArea = bbox
+	}
+	policy, err := osm2ch.ParseClipPolicy(*clipPolicy)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClipPolicy = policy
+
+	cfg.NodeStore, err = osm2ch.NodeStoreFactoryByName(*nodeStore, *nodeStoreDir)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DecoderProcs = *decoderProcs
+	cfg.Workers = *workers
+
+	cfg.IDs, err = osm2ch.ParseIDPolicy(*idPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if *idMappingFile != "" {
+		cfg.IDMapping, err = osm2ch.LoadIDMapping(*idMappingFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.Mode, err = osm2ch.ParseGraphMode(*graphMode)
+	if err != nil {
+		return nil, err
+	}
+	if *changesFile != "" && *stateFile == "" {
+		return nil, fmt.Errorf("Flag 'state' is required for applying of change file")
+	}
+	cfg.RestrictionDiagnostics = *restrictionsReport
+	cfg.Logger, err = prepareLogger()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// importGraph Imports graph from OSM files or applies change file to state of previous build. State and ID mapping are saved afterwards
+func importGraph(cfg *osm2ch.OsmConfiguration, outPrefix string) (*osm2ch.Graph, error) {
+	var importedGraph *osm2ch.Graph
+	if *changesFile != "" {
+		state, err := osm2ch.LoadState(*stateFile)
+		if err != nil {
+			return nil, failure(exitInput, err, "Can't load state")
+		}
+		var report *osm2ch.ChangeReport
+		importedGraph, report, err = osm2ch.UpdateFromOSCFile(*changesFile, state, cfg)
+		if err != nil {
+			return nil, failure(importExitCode(err), err, "Can't apply changes")
 		}
+		err = state.Save(*stateFile)
+		if err != nil {
+			return nil, failure(exitOutput, err, "Can't save state")
+		}
+		err = writeChangeReport(outPrefix+"_changes.csv", report)
+		if err != nil {
+			return nil, failure(exitOutput, err, "Can't write report of changes")
+		}
+		if len(report.SkippedWays) != 0 {
+			err = writeSkippedWays(outPrefix+"_skipped_ways.csv", report.SkippedWays)
+			if err != nil {
+				return nil, failure(exitOutput, err, "Can't write skipped ways")
+			}
+			fmt.Fprintf(os.Stderr, "osm2ch: warning: %d ways have been skipped since some of their nodes are missing, see '%s'\n", len(report.SkippedWays), outPrefix+"_skipped_ways.csv")
+		}
+	} else {
+		if *stateFile != "" {
+			cfg.State = osm2ch.NewState()
+		}
+		fileNames, err := osmFileNames.expand("my_graph.osm.pbf")
+		if err != nil {
+			return nil, failure(exitInput, err, "Bad list of OSM files")
+		}
+		importedGraph, err = osm2ch.ImportGraphFromOSMFiles(fileNames, cfg)
+		if err != nil {
+			return nil, failure(importExitCode(err), err, "Can't import graph")
+		}
+		if cfg.State != nil {
+			err = cfg.State.Save(*stateFile)
+			if err != nil {
+				return nil, failure(exitOutput, err, "Can't save state")
+			}
+		}
+	}
+	if cfg.IDMapping != nil {
+		err := cfg.IDMapping.Save(*idMappingFile)
+		if err != nil {
+			return nil, failure(exitOutput, err, "Can't save ID mapping")
+		}
+	}
+	return importedGraph, nil
+}
 
+// edgeCost Returns weight of edge with respect to 'weight' and 'units' flags
+func edgeCost(edge outputEdge) float64 {
+	if strings.ToLower(*weightType) == "time" {
+		return edge.costSeconds
+	}
+	if strings.ToLower(*units) != "m" {
+		return edge.costMeters / 1000.0
+	}
+	return edge.costMeters
+}
+
+// prepareCHGraph Creates graph for contraction hierarchies and collects geometries of its vertices
+func prepareCHGraph(outputEdges []outputEdge) (*ch.Graph, map[int64]osm2ch.GeoPoint, error) {
+	verticesGeoms := make(map[int64]osm2ch.GeoPoint)
+	graph := &ch.Graph{}
+	for _, edge := range outputEdges {
+		source := edge.source
+		target := edge.target
+		err := graph.CreateVertex(source)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Can not create source vertex %d", source)
+		}
+		err = graph.CreateVertex(target)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Can not create target vertex %d", target)
+		}
+		err = graph.AddEdge(source, target, edgeCost(edge))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Can not wrap Source (%d) and Targed (%d) vertices as Edge", source, target)
+		}
+		if len(edge.geom) < 2 {
+			continue
+		}
 		if _, ok := verticesGeoms[source]; !ok {
-			verticesGeoms[source] = osm2ch.GeoPoint{Lon: edge.Geom[0].Lon, Lat: edge.Geom[0].Lat}
+			verticesGeoms[source] = osm2ch.GeoPoint{Lon: edge.geom[0].Lon, Lat: edge.geom[0].Lat}
 		}
 		if _, ok := verticesGeoms[target]; !ok {
-			verticesGeoms[target] = osm2ch.GeoPoint{Lon: edge.Geom[len(edge.Geom)-1].Lon, Lat: edge.Geom[len(edge.Geom)-1].Lat}
+			verticesGeoms[target] = osm2ch.GeoPoint{Lon: edge.geom[len(edge.geom)-1].Lon, Lat: edge.geom[len(edge.geom)-1].Lat}
+		}
+	}
+	return graph, verticesGeoms, nil
+}
+
+// contract Prepares contraction hierarchies. Panic of library is turned into error
+func contract(graph *ch.Graph) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
 		}
+	}()
+	graph.PrepareContractionHierarchies()
+	return nil
+}
 
-		err = writerEdges.Write([]string{
-			fmt.Sprintf("%d", source),
-			fmt.Sprintf("%d", target),
-			fmt.Sprintf("%f", cost),
+// writeEdges Writes edges to CSV file. Returns number of edges which have been skipped because of missing geometry
+func writeEdges(fileName string, header []string, outputEdges []outputEdge) (int, error) {
+	fileEdges, err := os.Create(fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer fileEdges.Close()
+	writerEdges := csv.NewWriter(fileEdges)
+	writerEdges.Comma = ';'
+	err = writerEdges.Write(header)
+	if err != nil {
+		return 0, err
+	}
+	skipped := 0
+	for _, edge := range outputEdges {
+		if len(edge.geom) < 2 {
+			// Skip bad expanded edges
+			skipped++
+			continue
+		}
+		geomStr := ""
+		if strings.ToLower(*geomFormat) == "geojson" {
+			geomStr, err = osm2ch.PrepareGeoJSONLinestring(edge.geom)
+			if err != nil {
+				return 0, err
+			}
+		} else {
+			geomStr = osm2ch.PrepareWKTLinestring(edge.geom)
+		}
+		err = writerEdges.Write(append([]string{
+			fmt.Sprintf("%d", edge.source),
+			fmt.Sprintf("%d", edge.target),
+			fmt.Sprintf("%f", edgeCost(edge)),
 			geomStr,
-			fmt.Sprintf("%t", edge.WasOneway),
-			fmt.Sprintf("%d", edge.ID),
-			fmt.Sprintf("%d", edge.SourceOSMWayID),
-			fmt.Sprintf("%d", edge.TargetOSMWayID),
-			fmt.Sprintf("%d", edge.SourceComponent.SourceNodeID), fmt.Sprintf("%d", edge.SourceComponent.TargetNodeID),
-			fmt.Sprintf("%d", edge.TargetComponent.SourceNodeID), fmt.Sprintf("%d", edge.TargetComponent.TargetNodeID),
-		})
-
+		}, edge.extra...))
 		if err != nil {
-			fmt.Println(err)
-			return
+			return 0, err
 		}
 	}
-
-	if *doContraction {
-		fmt.Println("Starting contraction process....")
-		st := time.Now()
-		graph.PrepareContractionHierarchies()
-		fmt.Printf("Done contraction process in %v\n", time.Since(st))
+	writerEdges.Flush()
+	if err := writerEdges.Error(); err != nil {
+		return 0, err
 	}
+	return skipped, fileEdges.Close()
+}
 
-	/* Write vertices */
+// writeVertices Writes vertices of graph to CSV file. Duplicated vertices (see the ref. at osm2ch.Graph) are written with IDs of original ones
+func writeVertices(fileName string, graph *ch.Graph, verticesGeoms map[int64]osm2ch.GeoPoint, originals map[osm2ch.EdgeID]osm2ch.EdgeID) error {
+	fileVertices, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer fileVertices.Close()
+	writerVertices := csv.NewWriter(fileVertices)
+	writerVertices.Comma = ';'
+	// 		vertex_id - int64, ID of vertex
+	// 		order_pos - int, Position of vertex in hierarchies (evaluted by library)
+	// 		importance - int, Importance of vertex in graph (evaluted by library)
+	//      geom - geometry (WKT or GeoJSON representation)
+	// 		original_vertex_id - int64, ID of original vertex for vertices which have been duplicated by restrictions with via ways (ID of vertex itself otherwise)
+	err = writerVertices.Write([]string{"vertex_id", "order_pos", "importance", "geom", "original_vertex_id"})
+	if err != nil {
+		return err
+	}
 	vertices := graph.Vertices
 	for i := 0; i < len(vertices); i++ {
 		currentVertexExternal := vertices[i].Label
 		vertexGeom := verticesGeoms[currentVertexExternal]
 		geomStr := ""
 		if strings.ToLower(*geomFormat) == "geojson" {
-			geomStr = osm2ch.PrepareGeoJSONPoint(vertexGeom)
+			geomStr, err = osm2ch.PrepareGeoJSONPoint(vertexGeom)
+			if err != nil {
+				return err
+			}
 		} else {
 			geomStr = osm2ch.PrepareWKTPoint(vertexGeom)
 		}
+		originalVertex := currentVertexExternal
+		if original, ok := originals[osm2ch.EdgeID(currentVertexExternal)]; ok {
+			originalVertex = int64(original)
+		}
 		// Write reference information about vertex
 		err = writerVertices.Write([]string{
 			fmt.Sprintf("%d", currentVertexExternal),
 			fmt.Sprintf("%d", graph.Vertices[i].OrderPos()),
 			fmt.Sprintf("%d", graph.Vertices[i].Importance()),
 			fmt.Sprintf("%s", geomStr),
+			fmt.Sprintf("%d", originalVertex),
 		})
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
 	}
+	writerVertices.Flush()
+	if err := writerVertices.Error(); err != nil {
+		return err
+	}
+	return fileVertices.Close()
+}
 
-	if *doContraction {
-		/* Write shortcuts */
-		// 	from_vertex_id - int64, ID of source vertex
-		// 	to_vertex_id - int64, ID of arget vertex
-		// 	weight - float64, Weight of an edge
-		// 	via_vertex_id - int64, ID of vertex through which the shortcut exists
-		err = graph.ExportShortcutsToFile(fnameShortcuts)
+// parseReferenceTime Parses moment of time in RFC3339 format or in local format without time zone ('2006-01-02T15:04' / '2006-01-02 15:04')
+func parseReferenceTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Can't parse time '%s'. Expected format is RFC3339 or '2006-01-02T15:04'", value)
+}
+
+// writeStats Writes statistics of import to JSON file
+func writeStats(fileName string, stats *osm2ch.ImportStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(data, '\n'), 0644)
+}
+
+// writeRestrictionReports Writes diagnostics of restrictions to CSV file
+func writeRestrictionReports(fileName string, reports []osm2ch.RestrictionReport) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Comma = ';'
+	// 		relation_id - int64, ID of OSM relation
+	// 		type - string, Type of restriction (e.g. 'no_left_turn')
+	// 		members - string, Members of relation in form 'role:type:ref' separated by commas
+	// 		outcome - string, 'applied' or reason why restriction has been skipped
+	// 		removed_expanded_edges - string, IDs of expanded edges which have been removed by restriction separated by commas
+	err = writer.Write([]string{"relation_id", "type", "members", "outcome", "removed_expanded_edges"})
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		members := make([]string, len(report.Members))
+		for i, member := range report.Members {
+			members[i] = fmt.Sprintf("%s:%s:%d", member.Role, member.Type, member.Ref)
+		}
+		removed := make([]string, len(report.RemovedExpandedEdges))
+		for i, id := range report.RemovedExpandedEdges {
+			removed[i] = fmt.Sprintf("%d", id)
+		}
+		err = writer.Write([]string{
+			fmt.Sprintf("%d", report.ID),
+			report.Type,
+			strings.Join(members, ","),
+			report.Outcome.String(),
+			strings.Join(removed, ","),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeChangeReport Writes identifiers of added, removed and changed edges to CSV file
+func writeChangeReport(fileName string, report *osm2ch.ChangeReport) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Comma = ';'
+	// 		edge_id - int64, ID of edge (vertex of edge expanded graph)
+	// 		change - string, Type of change: added / removed / changed
+	err = writer.Write([]string{"edge_id", "change"})
+	if err != nil {
+		return err
+	}
+	for _, group := range []struct {
+		change string
+		ids    []osm2ch.EdgeID
+	}{
+		{"added", report.AddedEdges},
+		{"removed", report.RemovedEdges},
+		{"changed", report.ChangedEdges},
+	} {
+		for _, id := range group.ids {
+			err = writer.Write([]string{fmt.Sprintf("%d", id), group.change})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeSkippedWays Writes identifiers of ways which have been skipped during applying of changes to CSV file
+func writeSkippedWays(fileName string, ids []osm.WayID) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	writer.Comma = ';'
+	// 		way_id - int64, ID of OSM way
+	err = writer.Write([]string{"way_id"})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err = writer.Write([]string{fmt.Sprintf("%d", id)})
 		if err != nil {
-			fmt.Println(err)
-			return
+			return err
 		}
 	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// outputEdge Edge of output graph (either edge expanded or node based one)
+type outputEdge struct {
+	source      int64
+	target      int64
+	costMeters  float64
+	costSeconds float64
+	geom        []osm2ch.GeoPoint
+	// Values of columns which are specific for type of graph
+	extra []string
+}
+
+// prepareExpandedEdges Returns header of CSV file and edges of edge expanded graph
+func prepareExpandedEdges(expandedEdges []osm2ch.ExpandedEdge) ([]string, []outputEdge) {
+	// 		from_vertex_id - int64, ID of generated source vertex
+	// 		to_vertex_id - int64, ID of generated target vertex
+	// 		weight - float64, Weight of an edge (meters/kilometers or seconds)
+	//      geom - geometry (WKT or GeoJSON representation)
+	//      was_one_way - if edge was one way
+	//      edge_id - int64, ID of generated edge
+	// 		osm_way_from - int64, ID of source OSM Way
+	// 		osm_way_to - int64, ID of target OSM Way
+	// 		osm_way_from_source_node - int64, ID of first OSM Node in source OSM Way
+	// 		osm_way_from_target_node - int64, ID of last OSM Node in source OSM Way
+	// 		osm_way_to_source_node - int64, ID of first OSM Node in target OSM Way
+	// 		osm_way_to_target_node - int64, ID of last OSM Node in target OSM Way
+	header := []string{"from_vertex_id", "to_vertex_id", "weight", "geom", "was_one_way", "edge_id", "osm_way_from", "osm_way_to", "osm_way_from_source_node", "osm_way_from_target_node", "osm_way_to_source_node", "osm_way_to_target_node"}
+	result := make([]outputEdge, 0, len(expandedEdges))
+	for _, edge := range expandedEdges {
+		result = append(result, outputEdge{
+			source:      int64(edge.Source),
+			target:      int64(edge.Target),
+			costMeters:  edge.CostMeters,
+			costSeconds: edge.CostSeconds,
+			geom:        edge.Geom,
+			extra: []string{
+				fmt.Sprintf("%t", edge.WasOneway),
+				fmt.Sprintf("%d", edge.ID),
+				fmt.Sprintf("%d", edge.SourceOSMWayID),
+				fmt.Sprintf("%d", edge.TargetOSMWayID),
+				fmt.Sprintf("%d", edge.SourceComponent.SourceNodeID), fmt.Sprintf("%d", edge.SourceComponent.TargetNodeID),
+				fmt.Sprintf("%d", edge.TargetComponent.SourceNodeID), fmt.Sprintf("%d", edge.TargetComponent.TargetNodeID),
+			},
+		})
+	}
+	return header, result
+}
+
+// prepareNodeBasedEdges Returns header of CSV file and edges of node based graph
+func prepareNodeBasedEdges(edges []osm2ch.Edge) ([]string, []outputEdge) {
+	// 		from_vertex_id - int64, ID of source OSM Node
+	// 		to_vertex_id - int64, ID of target OSM Node
+	// 		weight - float64, Weight of an edge (meters/kilometers or seconds)
+	//      geom - geometry (WKT or GeoJSON representation)
+	//      was_one_way - if edge was one way
+	//      edge_id - int64, ID of generated edge
+	// 		osm_way - int64, ID of OSM Way
+	header := []string{"from_vertex_id", "to_vertex_id", "weight", "geom", "was_one_way", "edge_id", "osm_way"}
+	result := make([]outputEdge, 0, len(edges))
+	for _, edge := range edges {
+		result = append(result, outputEdge{
+			source:      int64(edge.SourceNodeID),
+			target:      int64(edge.TargetNodeID),
+			costMeters:  edge.CostMeters,
+			costSeconds: edge.CostSeconds,
+			geom:        edge.Geom,
+			extra: []string{
+				fmt.Sprintf("%t", edge.WasOneway),
+				fmt.Sprintf("%d", edge.ID),
+				fmt.Sprintf("%d", edge.WayID),
+			},
+		})
+	}
+	return header, result
 }
@@ -0,0 +1,322 @@
+package osm2ch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+const (
+	conditionalSuffix = ":conditional"
+	minutesInDay      = 24 * 60
+)
+
+// conditionalValue Single value of conditional tag and condition when it is applied
+type conditionalValue struct {
+	Value     string
+	Condition string
+}
+
+// parseConditional Splits value of conditional tag into values and conditions
+/*
+	E.g. 'no @ (Mo-Fr 07:00-09:00; Sa 10:00-12:00); destination @ Su' gives two values:
+		'no' with condition 'Mo-Fr 07:00-09:00; Sa 10:00-12:00'
+		'destination' with condition 'Su'
+	See the ref.: https://wiki.openstreetmap.org/wiki/Conditional_restrictions
+*/
+func parseConditional(value string) []conditionalValue {
+	parts := []string{}
+	depth, start := 0, 0
+	for i, r := range value {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ';':
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, value[start:])
+
+	values := []conditionalValue{}
+	for _, part := range parts {
+		idx := strings.Index(part, "@")
+		if idx < 0 {
+			continue
+		}
+		condition := strings.TrimSpace(part[idx+1:])
+		if strings.HasPrefix(condition, "(") && strings.HasSuffix(condition, ")") {
+			condition = strings.TrimSpace(condition[1 : len(condition)-1])
+		}
+		values = append(values, conditionalValue{
+			Value:     strings.TrimSpace(part[:idx]),
+			Condition: condition,
+		})
+	}
+	return values
+}
+
+// applyConditionalTags Returns copy of tags where value of every 'key' tag is overridden by value of 'key:conditional' tag if its condition holds at given time
+/*
+	If several conditions hold then the last one wins. Conditions which are not time based (e.g. 'weight>7.5' or 'wet') are never satisfied.
+	Conditional tags themselves are kept as is
+*/
+func applyConditionalTags(tags osm.Tags, at time.Time) osm.Tags {
+	result := make(osm.Tags, len(tags))
+	copy(result, tags)
+	for _, tag := range tags {
+		if !strings.HasSuffix(tag.Key, conditionalSuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(tag.Key, conditionalSuffix)
+		value, ok := "", false
+		for _, conditional := range parseConditional(tag.Value) {
+			if conditionHolds(conditional.Condition, at) {
+				value, ok = conditional.Value, true
+			}
+		}
+		if !ok {
+			continue
+		}
+		replaced := false
+		for i := range result {
+			if result[i].Key == key {
+				result[i].Value = value
+				replaced = true
+			}
+		}
+		if !replaced {
+			result = append(result, osm.Tag{Key: key, Value: value})
+		}
+	}
+	return result
+}
+
+// resolveTags Evaluates conditional tags at reference time of configuration. Returns tags as is if reference time is not set
+func (cfg *OsmConfiguration) resolveTags(tags osm.Tags) osm.Tags {
+	if cfg.ReferenceTime == nil {
+		return tags
+	}
+	return applyConditionalTags(tags, *cfg.ReferenceTime)
+}
+
+// conditionHolds Checks if condition of conditional tag holds at given time. Only time based conditions (subset of 'opening_hours' syntax) are supported
+func conditionHolds(condition string, at time.Time) bool {
+	hours, err := parseOpeningHours(condition)
+	if err != nil {
+		return false
+	}
+	return hours.isOpen(at)
+}
+
+// openingHours Parsed value in 'opening_hours' syntax
+/*
+	Supported subset: rules separated by ';', months ('Jan-Mar', 'Dec'), weekdays ('Mo-Fr', 'Sa,Su'),
+	time ranges ('07:00-09:00,16:00-18:00', ranges over midnight like '22:00-06:00'), '24/7' and 'off'.
+	See the ref.: https://wiki.openstreetmap.org/wiki/Key:opening_hours/specification
+*/
+type openingHours []openingHoursRule
+
+// openingHoursRule Single rule of 'opening_hours' value
+type openingHoursRule struct {
+	months   map[int]bool
+	weekdays map[int]bool
+	times    []timeRange
+	off      bool
+}
+
+// timeRange Range of minutes since midnight. If end is not greater than start then range goes over midnight
+type timeRange struct {
+	start int
+	end   int
+}
+
+var (
+	// Values are the same as for time.Weekday
+	weekdayNames = map[string]int{
+		"Su": 0, "Mo": 1, "Tu": 2, "We": 3, "Th": 4, "Fr": 5, "Sa": 6,
+	}
+	// Values are the same as for time.Month minus one
+	monthNames = map[string]int{
+		"Jan": 0, "Feb": 1, "Mar": 2, "Apr": 3, "May": 4, "Jun": 5,
+		"Jul": 6, "Aug": 7, "Sep": 8, "Oct": 9, "Nov": 10, "Dec": 11,
+	}
+)
+
+// parseOpeningHours Parses value in 'opening_hours' syntax. Returns error for unsupported syntax
+func parseOpeningHours(value string) (openingHours, error) {
+	hours := openingHours{}
+	for _, ruleStr := range strings.Split(value, ";") {
+		ruleStr = strings.TrimSpace(ruleStr)
+		if ruleStr == "" {
+			continue
+		}
+		rule := openingHoursRule{}
+		for _, token := range strings.Fields(ruleStr) {
+			var err error
+			switch {
+			case token == "24/7":
+				rule.times = append(rule.times, timeRange{0, minutesInDay})
+			case token == "off" || token == "closed":
+				rule.off = true
+			case strings.Contains(token, ":"):
+				err = rule.parseTimes(token)
+			case isNamesList(token, monthNames):
+				rule.months, err = parseNamesList(token, monthNames, 12)
+			case isNamesList(token, weekdayNames):
+				rule.weekdays, err = parseNamesList(token, weekdayNames, 7)
+			default:
+				err = fmt.Errorf("Unsupported token '%s' in opening hours '%s'", token, value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		hours = append(hours, rule)
+	}
+	if len(hours) == 0 {
+		return nil, fmt.Errorf("Empty opening hours")
+	}
+	return hours, nil
+}
+
+// isOpen Checks if given time is covered by opening hours. Later rules override earlier ones for the same day
+func (hours openingHours) isOpen(at time.Time) bool {
+	minute := at.Hour()*60 + at.Minute()
+	previousDay := at.AddDate(0, 0, -1)
+	open := false
+	for _, rule := range hours {
+		// Time ranges over midnight of the previous day
+		spill := rule.matchDay(previousDay) && rule.spillsOver(minute)
+		if rule.matchDay(at) {
+			// Rule overrides previous ones for its days. Both ranges of the day and ranges of the previous day are taken into account
+			open = !rule.off && (rule.containsMinute(minute) || spill)
+			continue
+		}
+		if !rule.off && spill {
+			open = true
+		}
+	}
+	return open
+}
+
+// matchDay Checks if month and weekday selectors of rule match given date
+func (rule openingHoursRule) matchDay(at time.Time) bool {
+	if len(rule.months) != 0 && !rule.months[int(at.Month())-1] {
+		return false
+	}
+	if len(rule.weekdays) != 0 && !rule.weekdays[int(at.Weekday())] {
+		return false
+	}
+	return true
+}
+
+// containsMinute Checks if minute of the day is covered by time ranges of rule. Rule without time ranges covers the whole day
+func (rule openingHoursRule) containsMinute(minute int) bool {
+	if len(rule.times) == 0 {
+		return true
+	}
+	for _, tr := range rule.times {
+		if tr.end > tr.start {
+			if minute >= tr.start && minute < tr.end {
+				return true
+			}
+		} else if minute >= tr.start {
+			return true
+		}
+	}
+	return false
+}
+
+// spillsOver Checks if minute of the day is covered by time ranges of rule which go over midnight of the previous day
+func (rule openingHoursRule) spillsOver(minute int) bool {
+	for _, tr := range rule.times {
+		if tr.end <= tr.start && minute < tr.end {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimes Parses list of time ranges (e.g. '07:00-09:00,16:00-18:00')
+func (rule *openingHoursRule) parseTimes(token string) error {
+	for _, rangeStr := range strings.Split(token, ",") {
+		bounds := strings.Split(rangeStr, "-")
+		if len(bounds) != 2 {
+			return fmt.Errorf("Bad time range '%s'", rangeStr)
+		}
+		start, err := parseClock(bounds[0])
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(bounds[1])
+		if err != nil {
+			return err
+		}
+		rule.times = append(rule.times, timeRange{start, end})
+	}
+	return nil
+}
+
+// parseClock Returns minutes since midnight for 'HH:MM' string
+func parseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("Bad time '%s'", value)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("Bad time '%s'", value)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("Bad time '%s'", value)
+	}
+	minutes := h*60 + m
+	if h < 0 || m < 0 || m >= 60 || minutes > minutesInDay {
+		return 0, fmt.Errorf("Bad time '%s'", value)
+	}
+	return minutes, nil
+}
+
+// isNamesList Checks if every item of comma-separated list (items could be ranges like 'Mo-Fr') consists of known names
+func isNamesList(token string, names map[string]int) bool {
+	for _, item := range strings.Split(token, ",") {
+		for _, name := range strings.Split(item, "-") {
+			if _, ok := names[name]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseNamesList Parses comma-separated list of names and ranges of names (e.g. 'Mo-We,Fr' or 'Nov-Mar'). Ranges could wrap around (e.g. 'Fr-Mo')
+func parseNamesList(token string, names map[string]int, cycle int) (map[int]bool, error) {
+	result := make(map[int]bool)
+	for _, item := range strings.Split(token, ",") {
+		bounds := strings.Split(item, "-")
+		switch len(bounds) {
+		case 1:
+			result[names[bounds[0]]] = true
+		case 2:
+			from, to := names[bounds[0]], names[bounds[1]]
+			for i := from; ; i = (i + 1) % cycle {
+				result[i] = true
+				if i == to {
+					break
+				}
+			}
+		default:
+			return nil, fmt.Errorf("Bad range '%s'", item)
+		}
+	}
+	return result, nil
+}
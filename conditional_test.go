@@ -0,0 +1,70 @@
+package osm2ch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+func TestOpeningHours(t *testing.T) {
+	// 2021-03-01 is Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2021, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		condition string
+		at        time.Time
+		expected  bool
+	}{
+		{"Mo-Fr 07:00-09:00", monday(8, 0), true},
+		{"Mo-Fr 07:00-09:00", monday(9, 0), false},
+		{"Mo-Fr 07:00-09:00", monday(8, 0).AddDate(0, 0, 5), false},
+		{"Sa,Su", monday(12, 0).AddDate(0, 0, 6), true},
+		{"Fr-Mo 10:00-12:00", monday(11, 0), true},
+		{"Mo-Fr 07:00-09:00,16:00-18:00", monday(17, 0), true},
+		{"Mo-Fr 08:00-18:00; We off", monday(12, 0).AddDate(0, 0, 2), false},
+		{"Su 22:00-06:00", monday(5, 0), true},
+		{"22:00-06:00", monday(5, 0).AddDate(0, 0, 1), true},
+		{"22:00-06:00", monday(6, 0).AddDate(0, 0, 1), false},
+		{"Mo-Fr 22:00-06:00", monday(5, 0).AddDate(0, 0, 1), true},
+		{"Mo-Fr 22:00-06:00", monday(5, 0).AddDate(0, 0, 5), true},
+		{"Mo-Fr 22:00-06:00", monday(5, 0), false},
+		{"Mo-Fr 22:00-06:00", monday(23, 0), true},
+		{"Nov-Feb", monday(12, 0), false},
+		{"Dec-Mar Mo", monday(12, 0), true},
+		{"24/7", monday(3, 0), true},
+		{"weight>7.5", monday(8, 0), false},
+		{"wet", monday(8, 0), false},
+	}
+	for _, test := range tests {
+		if got := conditionHolds(test.condition, test.at); got != test.expected {
+			t.Errorf("Condition '%s' at %v: expected %t, got %t", test.condition, test.at, test.expected, got)
+		}
+	}
+}
+
+func TestApplyConditionalTags(t *testing.T) {
+	// Monday, 08:00
+	at := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	tags := osm.Tags{
+		{Key: "highway", Value: "residential"},
+		{Key: "access", Value: "yes"},
+		{Key: "access:conditional", Value: "no @ (Mo-Fr 07:00-09:00; Sa 10:00-12:00); destination @ Su"},
+		{Key: "restriction:conditional", Value: "no_left_turn @ (Mo-Fr 07:00-09:00)"},
+		{Key: "maxspeed:conditional", Value: "30 @ (22:00-06:00)"},
+	}
+	resolved := applyConditionalTags(tags, at)
+	if v := resolved.Find("access"); v != "no" {
+		t.Errorf("Access should be 'no', got '%s'", v)
+	}
+	if v := resolved.Find("restriction"); v != "no_left_turn" {
+		t.Errorf("Restriction should be 'no_left_turn', got '%s'", v)
+	}
+	if v := resolved.Find("maxspeed"); v != "" {
+		t.Errorf("Maxspeed should not be set, got '%s'", v)
+	}
+	if v := tags.Find("access"); v != "yes" {
+		t.Errorf("Source tags should not be modified")
+	}
+}
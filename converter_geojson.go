@@ -1,31 +1,28 @@
 package osm2ch
 
 import (
-	"fmt"
-
 	geojson "github.com/paulmach/go.geojson"
+	"github.com/pkg/errors"
 )
 
 // PrepareGeoJSONLinestring returns GeoJSON representation of LineString
-func PrepareGeoJSONLinestring(pts []GeoPoint) string {
+func PrepareGeoJSONLinestring(pts []GeoPoint) (string, error) {
 	pts2d := make([][]float64, len(pts))
 	for i := range pts {
 		pts2d[i] = []float64{pts[i].Lon, pts[i].Lat}
 	}
 	b, err := geojson.NewLineStringGeometry(pts2d).MarshalJSON()
 	if err != nil {
-		fmt.Printf("Warning. Can not convert geometry to geojson format: %s", err.Error())
-		return ""
+		return "", errors.Wrap(err, "Can not convert geometry to geojson format")
 	}
-	return string(b)
+	return string(b), nil
 }
 
 // PrepareGeoJSONPoint returns GeoJSON representation of Point
-func PrepareGeoJSONPoint(pt GeoPoint) string {
+func PrepareGeoJSONPoint(pt GeoPoint) (string, error) {
 	b, err := geojson.NewPointGeometry([]float64{pt.Lon, pt.Lat}).MarshalJSON()
 	if err != nil {
-		fmt.Printf("Warning. Can not convert geometry to geojson format: %s", err.Error())
-		return ""
+		return "", errors.Wrap(err, "Can not convert geometry to geojson format")
 	}
-	return string(b)
+	return string(b), nil
 }
@@ -13,7 +13,81 @@ type Edge struct {
 	TargetNodeID osm.NodeID
 	WasOneway    bool
 	CostMeters   float64
-	/* CostSeconds  float64 */ //@todo: consider cost customization
-	Geom                       []GeoPoint
-	Tags                       osm.Tags
+	CostSeconds  float64
+	Geom         []GeoPoint
+	Tags         osm.Tags
+}
+
+// prepareEdges Splits ways into edges by nodes which are used more than once (crossroads, endpoints of ways and significant nodes)
+/*
+	Ways are split into contiguous chunks which are processed by workers concurrently.
+	Results of chunks are concatenated in order of ways, so output doesn't depend on number of workers. IDs of edges are not set
+*/
+func prepareEdges(ways []Way, refs *nodeRefs, nodes NodeStore, profile Profile, workers int) []Edge {
+	chunks := make([][]Edge, workers)
+	parallelChunks(len(ways), workers, func(chunk, from, to int) {
+		result := []Edge{}
+		for _, way := range ways[from:to] {
+			result = append(result, wayEdges(way, refs, nodes, profile)...)
+		}
+		chunks[chunk] = result
+	})
+	total := 0
+	for _, chunk := range chunks {
+		total += len(chunk)
+	}
+	edges := make([]Edge, 0, total)
+	for _, chunk := range chunks {
+		edges = append(edges, chunk...)
+	}
+	return edges
+}
+
+// wayEdges Returns edges of single way. IDs of edges are not set
+func wayEdges(way Way, refs *nodeRefs, nodes NodeStore, profile Profile) []Edge {
+	edges := []Edge{}
+	var source osm.NodeID
+	speedForward := profile.Speed(way.TagMap, true)
+	speedBackward := profile.Speed(way.TagMap, false)
+	penalty := profile.Penalty(way.TagMap) * way.accessPenalty
+	geometry := []GeoPoint{}
+	for i, wayNode := range way.Nodes {
+		pt, _ := nodes.Get(wayNode.ID)
+		geometry = append(geometry, pt)
+		if i == 0 {
+			source = wayNode.ID
+			continue
+		}
+		if refs.useCounts[refs.index(wayNode.ID)] <= 1 {
+			continue
+		}
+		cost := getSphericalLength(geometry) * 1000.0 // meters
+		if way.Direction.Forward() {
+			edges = append(edges, Edge{
+				WayID:        way.ID,
+				SourceNodeID: source,
+				TargetNodeID: wayNode.ID,
+				CostMeters:   cost,
+				CostSeconds:  travelTime(cost, speedForward) * penalty,
+				Geom:         copyLine(geometry),
+				WasOneway:    way.Direction.Oneway(),
+				Tags:         way.TagMap,
+			})
+		}
+		if way.Direction.Backward() {
+			edges = append(edges, Edge{
+				WayID:        way.ID,
+				SourceNodeID: wayNode.ID,
+				TargetNodeID: source,
+				CostMeters:   cost,
+				CostSeconds:  travelTime(cost, speedBackward) * penalty,
+				Geom:         reverseLine(geometry),
+				WasOneway:    way.Direction.Oneway(),
+				Tags:         way.TagMap,
+			})
+		}
+		source = wayNode.ID
+		geometry = []GeoPoint{pt}
+	}
+	return edges
 }
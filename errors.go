@@ -0,0 +1,53 @@
+package osm2ch
+
+import (
+	"context"
+	"fmt"
+)
+
+// CancelledError Error which is returned when import is cancelled via context
+type CancelledError struct {
+	// Stage of import which has been interrupted: 'ways', 'nodes', 'relations', 'changes', 'edges', 'expanding' or 'restrictions'
+	Stage string
+	// Error of context: context.Canceled or context.DeadlineExceeded
+	Err error
+}
+
+// Error See the ref. at error interface
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("Import has been cancelled on stage '%s': %v", e.Stage, e.Err)
+}
+
+// Unwrap Returns error of context, so errors.Is(err, context.Canceled) works
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError Error which is returned when OSM data (or OSM change file) is malformed or has unsupported format
+/*
+	It allows to distinguish bad input data from other failures of import (e.g. I/O errors or inconsistent data)
+*/
+type ParseError struct {
+	// What has been parsed: 'format', 'ways', 'nodes', 'relations' or 'changes'
+	Stage string
+	// Error of decoder
+	Err error
+}
+
+// Error See the ref. at error interface
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Can't parse OSM data on stage '%s': %v", e.Stage, e.Err)
+}
+
+// Unwrap Returns error of decoder
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// checkCancelled Returns CancelledError for given stage if context is done
+func checkCancelled(ctx context.Context, stage string) error {
+	if err := ctx.Err(); err != nil {
+		return &CancelledError{Stage: stage, Err: err}
+	}
+	return nil
+}
@@ -13,8 +13,12 @@ type ExpandedEdge struct {
 	TargetComponent ExpandedEdgeComponent
 	WasOneway       bool
 	CostMeters      float64
-	/* CostSeconds  float64 */ //@todo: consider cost customization
-	Geom                       []GeoPoint
+	CostSeconds     float64
+	// Angle of turn (degrees, positive values are right turns and negative values are left turns)
+	TurnAngle float64
+	// Time penalty for turn and for passing through via node (seconds). It is included into CostSeconds already
+	TurnCostSeconds float64
+	Geom            []GeoPoint
 }
 
 // ExpandedEdgeComponent represents former Way
@@ -23,10 +27,106 @@ type ExpandedEdgeComponent struct {
 	TargetNodeID osm.NodeID
 	Tags         osm.Tags
 	CostMeters   float64
+	CostSeconds  float64
 }
 
-// restrictionComponent represents member of restriction relation. Could be either way or node.
-type restrictionComponent struct {
-	ID   int64
-	Type string
+// expandEdges Applies edge expanding technique: every edge becomes vertex and every possible turn between edges becomes edge.
+// Costs of nodes are added to turns through them and turns through blocked nodes are skipped.
+// IDs of edges should be set already, IDs of expanded edges are not set.
+// Returns expanded edges and number of ignored cycles (U-turns on the same segment)
+func expandEdges(edges []Edge, nodeCosts map[osm.NodeID]nodeCost, cfg *OsmConfiguration) ([]ExpandedEdge, int) {
+	// create index of edges (positions in slice) by SourceNodeID
+	edgesBySourceNodeID := make(map[osm.NodeID][]int)
+	for i, edge := range edges {
+		edgesBySourceNodeID[edge.SourceNodeID] = append(edgesBySourceNodeID[edge.SourceNodeID], i)
+	}
+
+	// Edges are split into contiguous chunks which are expanded concurrently. Index is read-only at this point
+	workers := cfg.workers()
+	chunks := make([][]ExpandedEdge, workers)
+	chunksCycles := make([]int, workers)
+	parallelChunks(len(edges), workers, func(chunk, from, to int) {
+		chunks[chunk], chunksCycles[chunk] = expandEdgesChunk(edges, edges[from:to], edgesBySourceNodeID, nodeCosts, cfg)
+	})
+
+	// Concatenate results in order of source edges, so output doesn't depend on number of workers
+	cycles, total := 0, 0
+	for chunk := range chunks {
+		cycles += chunksCycles[chunk]
+		total += len(chunks[chunk])
+	}
+	expandedEdges := make([]ExpandedEdge, 0, total)
+	for _, chunk := range chunks {
+		expandedEdges = append(expandedEdges, chunk...)
+	}
+	return expandedEdges, cycles
+}
+
+// expandEdgesChunk Expands turns from given subset of edges. IDs of expanded edges are not set
+func expandEdgesChunk(edges, fromEdges []Edge, edgesBySourceNodeID map[osm.NodeID][]int, nodeCosts map[osm.NodeID]nodeCost, cfg *OsmConfiguration) ([]ExpandedEdge, int) {
+	cycles := 0
+	expandedEdges := []ExpandedEdge{}
+	for _, edge := range fromEdges {
+		edgeAsFromVertex := edge
+		costMetersFromVertex := edgeAsFromVertex.CostMeters
+		costSecondsFromVertex := edgeAsFromVertex.CostSeconds
+		viaCost := nodeCosts[edgeAsFromVertex.TargetNodeID]
+		if viaCost.blocked {
+			continue
+		}
+		outcomingEdges := edgesBySourceNodeID[edgeAsFromVertex.TargetNodeID]
+		for _, outcomingEdge := range outcomingEdges {
+			edgeAsToVertex := edges[outcomingEdge]
+			if edgeAsToVertex.ID == edgeAsFromVertex.ID {
+				continue
+			}
+			// cycles, u-turn?
+			// @todo: some of those are deadend (or 'boundary') edges
+			if edgeAsFromVertex.Geom[0] == edgeAsToVertex.Geom[len(edgeAsToVertex.Geom)-1] && edgeAsFromVertex.Geom[len(edgeAsFromVertex.Geom)-1] == edgeAsToVertex.Geom[0] {
+				// fmt.Println(PrepareGeoJSONLinestring(edgeAsFromVertex.Geom))
+				cycles++
+				continue
+			}
+			costMetersToVertex := edgeAsToVertex.CostMeters
+			costSecondsToVertex := edgeAsToVertex.CostSeconds
+			angle := turnAngle(edgeAsFromVertex.Geom, edgeAsToVertex.Geom)
+			turnCostSeconds := cfg.TurnCosts.Cost(angle) + viaCost.seconds
+			if edgeAsFromVertex.WayID != edgeAsToVertex.WayID {
+				turnCostSeconds += cfg.TurnPenalty
+			}
+			beforeFromIdx, fromMiddlePoint := findMiddlePoint(edgeAsFromVertex.Geom)
+			fromGeomHalf := append([]GeoPoint{fromMiddlePoint}, edgeAsFromVertex.Geom[beforeFromIdx+1:len(edgeAsFromVertex.Geom)]...)
+			beforeToIdx, toMiddlePoint := findMiddlePoint(edgeAsToVertex.Geom)
+			toGeomHalf := append(make([]GeoPoint, 0, len(edgeAsToVertex.Geom[:beforeToIdx+1])+1), edgeAsToVertex.Geom[:beforeToIdx+1]...)
+			toGeomHalf = append(toGeomHalf, toMiddlePoint)
+			completedNewGeom := append(fromGeomHalf, toGeomHalf...)
+			expandedEdges = append(expandedEdges, ExpandedEdge{
+				Source:         edgeAsFromVertex.ID,
+				Target:         edgeAsToVertex.ID,
+				SourceOSMWayID: edgeAsFromVertex.WayID,
+				TargetOSMWayID: edgeAsToVertex.WayID,
+				SourceComponent: ExpandedEdgeComponent{
+					SourceNodeID: edgeAsFromVertex.SourceNodeID,
+					TargetNodeID: edgeAsFromVertex.TargetNodeID,
+					Tags:         edgeAsFromVertex.Tags,
+					CostMeters:   costMetersFromVertex / 2.0,
+					CostSeconds:  costSecondsFromVertex / 2.0,
+				},
+				TargetComponent: ExpandedEdgeComponent{
+					SourceNodeID: edgeAsToVertex.SourceNodeID,
+					TargetNodeID: edgeAsToVertex.TargetNodeID,
+					Tags:         edgeAsToVertex.Tags,
+					CostMeters:   costMetersToVertex / 2.0,
+					CostSeconds:  costSecondsToVertex / 2.0,
+				},
+				CostMeters:      (costMetersFromVertex + costMetersToVertex) / 2.0,
+				CostSeconds:     (costSecondsFromVertex+costSecondsToVertex)/2.0 + turnCostSeconds,
+				TurnAngle:       angle,
+				TurnCostSeconds: turnCostSeconds,
+				WasOneway:       edgeAsFromVertex.WasOneway,
+				Geom:            completedNewGeom,
+			})
+		}
+	}
+	return expandedEdges, cycles
 }
@@ -0,0 +1,102 @@
+package osm2ch
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmxml"
+	"github.com/pkg/errors"
+)
+
+// InputFormat Format of OSM data
+type InputFormat uint16
+
+const (
+	// Detect format by content (magic bytes) of data
+	FormatAuto = InputFormat(iota)
+	// Protocolbuffer Binary Format (*.osm.pbf)
+	FormatPBF
+	// XML (*.osm)
+	FormatXML
+	// XML compressed by bzip2 (*.osm.bz2)
+	FormatXMLBzip2
+)
+
+// String returns pretty printed value for InputFormat
+func (format InputFormat) String() string {
+	switch format {
+	case FormatAuto:
+		return "auto"
+	case FormatPBF:
+		return "pbf"
+	case FormatXML:
+		return "xml"
+	case FormatXMLBzip2:
+		return "xml+bzip2"
+	default:
+		return fmt.Sprintf("unknown(%d)", format)
+	}
+}
+
+// formatByExtension Returns format of OSM data by file name. Returns FormatAuto if extension is unknown
+func formatByExtension(fileName string) InputFormat {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".pbf":
+		return FormatPBF
+	case ".osm", ".xml":
+		return FormatXML
+	case ".bz2":
+		return FormatXMLBzip2
+	default:
+		return FormatAuto
+	}
+}
+
+// detectFormat Returns format of OSM data by its first bytes. Source is seeked back to the start
+/*
+	bzip2 streams start with 'BZh', XML data starts with '<' (after optional BOM and whitespaces)
+	and PBF data starts with length of the header blob followed by 'OSMHeader' string
+*/
+func detectFormat(r io.ReadSeeker) (InputFormat, error) {
+	head := make([]byte, 64)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatAuto, errors.Wrap(err, "Can't read data for format detection")
+	}
+	head = head[:n]
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return FormatAuto, errors.Wrap(err, "Can't seek after format detection")
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return FormatXMLBzip2, nil
+	case bytes.HasPrefix(bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n"), []byte("<")):
+		return FormatXML, nil
+	case bytes.Contains(head, []byte("OSMHeader")):
+		return FormatPBF, nil
+	default:
+		return FormatAuto, &ParseError{Stage: "format", Err: fmt.Errorf("Can't detect format of OSM data")}
+	}
+}
+
+// newScanner Creates scanner of OSM objects for data of given format. Procs is number of goroutines for decoding of PBF blocks
+func newScanner(ctx context.Context, r io.Reader, format InputFormat, procs int) (osm.Scanner, error) {
+	switch format {
+	case FormatPBF:
+		return osmpbf.New(ctx, r, procs), nil
+	case FormatXML:
+		return osmxml.New(ctx, r), nil
+	case FormatXMLBzip2:
+		return osmxml.New(ctx, bzip2.NewReader(r)), nil
+	default:
+		return nil, &ParseError{Stage: "format", Err: fmt.Errorf("Unsupported format of OSM data: %s", format)}
+	}
+}
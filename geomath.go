@@ -207,3 +207,13 @@ func reverseLineInPlace(pts []GeoPoint) {
 		pts[i], pts[j] = pts[j], pts[i]
 	}
 }
+
+// bearing returns initial bearing (degrees clockwise from north in range [0; 360)) for segment from p to q
+func bearing(p, q GeoPoint) float64 {
+	lat1 := degreesToRadians(p.Lat)
+	lat2 := degreesToRadians(q.Lat)
+	diffLon := degreesToRadians(q.Lon - p.Lon)
+	y := math.Sin(diffLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(diffLon)
+	return math.Mod(radiansTodegrees(math.Atan2(y, x))+360.0, 360.0)
+}
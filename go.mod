@@ -8,4 +8,5 @@ require (
 	github.com/paulmach/orb v0.5.0 // indirect
 	github.com/paulmach/osm v0.3.0
 	github.com/pkg/errors v0.9.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,76 @@
+package osm2ch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// GraphMode Type of graph which is produced by import
+type GraphMode uint16
+
+const (
+	// Edge expanded graph: edges of road network are vertices, turns between them are edges
+	GraphModeExpanded = GraphMode(iota)
+	// Node based graph: OSM nodes are vertices, segments of road network between them are edges.
+	// Turn restrictions and turn costs can't be represented in such graph
+	GraphModeNode
+)
+
+// String returns pretty printed value for GraphMode
+func (mode GraphMode) String() string {
+	switch mode {
+	case GraphModeExpanded:
+		return "expanded"
+	case GraphModeNode:
+		return "node"
+	default:
+		return fmt.Sprintf("unknown(%d)", mode)
+	}
+}
+
+// ParseGraphMode Returns graph mode for given name. Supported names are: 'expanded', 'node'
+func ParseGraphMode(name string) (GraphMode, error) {
+	switch strings.ToLower(name) {
+	case "expanded", "":
+		return GraphModeExpanded, nil
+	case "node":
+		return GraphModeNode, nil
+	default:
+		return GraphModeExpanded, fmt.Errorf("Unknown graph mode: '%s'", name)
+	}
+}
+
+// Graph Result of import of OSM data
+type Graph struct {
+	// Edges between OSM nodes.
+	// For GraphModeExpanded those are vertices of edge expanded graph.
+	// For GraphModeNode those are edges of resulting graph: edges leading to impassable nodes are removed and penalties of nodes are included into travel time of edges leading to them
+	Edges []Edge
+	// Edges of edge expanded graph. It is empty for GraphModeNode
+	ExpandedEdges []ExpandedEdge
+	// Vertices of edge expanded graph which have been duplicated by restrictions with via ways mapped to original ones (IDs of Edges).
+	// Route which ends on via way could arrive at duplicate, so duplicates should be treated as their originals when vertices are looked up.
+	// It is empty for GraphModeNode
+	OriginalVertices map[EdgeID]EdgeID
+	// Statistics of import
+	Stats ImportStats
+	// Diagnostics of restriction relations sorted by ID. It is filled only when RestrictionDiagnostics field of configuration is set
+	RestrictionReports []RestrictionReport
+}
+
+// nodeBasedEdges Prepares edges of node based graph: removes edges leading to impassable nodes and adds penalties of nodes to travel time of edges leading to them.
+// Returns new slice
+func nodeBasedEdges(edges []Edge, nodeCosts map[osm.NodeID]nodeCost) []Edge {
+	result := make([]Edge, 0, len(edges))
+	for _, edge := range edges {
+		cost := nodeCosts[edge.TargetNodeID]
+		if cost.blocked {
+			continue
+		}
+		edge.CostSeconds += cost.seconds
+		result = append(result, edge)
+	}
+	return result
+}
@@ -0,0 +1,299 @@
+package osm2ch
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// IDPolicy Defines how identifiers of edges (vertices of expanded graph) and expanded edges are generated
+type IDPolicy uint16
+
+const (
+	// Sequential numbers in order of OSM data. Any change of data shifts identifiers
+	IDsSequential = IDPolicy(iota)
+	// Identifiers are derived from OSM way and nodes of segment, so they survive rebuilding with fresher extract
+	IDsStable
+)
+
+const (
+	// Stable identifiers are kept below 2^62, so there is some room for arithmetic in downstream software
+	stableIDMask = 1<<62 - 1
+)
+
+// ParseIDPolicy Returns policy for given name. Supported names are: 'sequential', 'stable'
+func ParseIDPolicy(name string) (IDPolicy, error) {
+	switch strings.ToLower(name) {
+	case "sequential", "":
+		return IDsSequential, nil
+	case "stable":
+		return IDsStable, nil
+	default:
+		return IDsSequential, fmt.Errorf("Unknown ID policy: '%s'", name)
+	}
+}
+
+// SegmentKey Identifies edge by OSM data: way and its nodes in direction of travelling
+type SegmentKey struct {
+	WayID        osm.WayID
+	SourceNodeID osm.NodeID
+	TargetNodeID osm.NodeID
+}
+
+// TurnKey Identifies expanded edge by its source and target vertices
+type TurnKey struct {
+	Source EdgeID
+	Target EdgeID
+}
+
+// DuplicateKey Identifies vertex which is duplicated for restriction with via ways: original vertex reached from parent one
+type DuplicateKey struct {
+	Parent   EdgeID
+	Original EdgeID
+}
+
+// IDMapping Identifiers which have been assigned during previous builds
+/*
+	Mapping is updated by import: new segments and turns get new identifiers, removed ones are kept,
+	so their identifiers are never reused for other segments. Save mapping after import and pass it to the next build
+	to keep identifiers of unchanged segments even in case of hash collisions
+*/
+type IDMapping struct {
+	Edges         map[SegmentKey]EdgeID
+	Duplicates    map[DuplicateKey]EdgeID
+	ExpandedEdges map[TurnKey]int64
+}
+
+// NewIDMapping Creates empty mapping
+func NewIDMapping() *IDMapping {
+	return &IDMapping{
+		Edges:         make(map[SegmentKey]EdgeID),
+		Duplicates:    make(map[DuplicateKey]EdgeID),
+		ExpandedEdges: make(map[TurnKey]int64),
+	}
+}
+
+// LoadIDMapping Reads mapping from file. Returns empty mapping if file does not exist
+func LoadIDMapping(fileName string) (*IDMapping, error) {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return NewIDMapping(), nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open ID mapping file")
+	}
+	defer f.Close()
+	mapping := NewIDMapping()
+	if err := gob.NewDecoder(f).Decode(mapping); err != nil {
+		return nil, errors.Wrap(err, "Can't decode ID mapping file")
+	}
+	return mapping, nil
+}
+
+// Save Writes mapping to file
+func (mapping *IDMapping) Save(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, "Can't create ID mapping file")
+	}
+	if err := gob.NewEncoder(f).Encode(mapping); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Can't encode ID mapping file")
+	}
+	return errors.Wrap(f.Close(), "Can't close ID mapping file")
+}
+
+// idAssigner Generates identifiers of edges, duplicated vertices and expanded edges
+type idAssigner interface {
+	// assignEdges Sets identifiers of edges
+	assignEdges(edges []Edge)
+	// assignExpandedEdges Sets identifiers of expanded edges. Identifiers of edges should be assigned already
+	assignExpandedEdges(expandedEdges []ExpandedEdge)
+	// duplicateID Returns identifier for duplicate of original vertex reached from parent vertex
+	duplicateID(parent, original EdgeID) EdgeID
+	// expandedEdgeID Returns identifier for expanded edge created after assignExpandedEdges call (outcoming edge of duplicate)
+	expandedEdgeID(source, target EdgeID) int64
+}
+
+// idAssigner Returns generator of identifiers for configuration
+func (cfg *OsmConfiguration) idAssigner() idAssigner {
+	if cfg.IDMapping != nil {
+		return newStableIDs(cfg.IDMapping)
+	}
+	if cfg.IDs == IDsStable {
+		return newStableIDs(NewIDMapping())
+	}
+	return &sequentialIDs{}
+}
+
+// sequentialIDs Enumerates objects in order of their creation
+type sequentialIDs struct {
+	lastEdgeID     EdgeID
+	lastExpandedID int64
+}
+
+// assignEdges See the ref. at idAssigner interface
+func (ids *sequentialIDs) assignEdges(edges []Edge) {
+	for i := range edges {
+		ids.lastEdgeID++
+		edges[i].ID = ids.lastEdgeID
+	}
+}
+
+// assignExpandedEdges See the ref. at idAssigner interface
+func (ids *sequentialIDs) assignExpandedEdges(expandedEdges []ExpandedEdge) {
+	for i := range expandedEdges {
+		ids.lastExpandedID++
+		expandedEdges[i].ID = ids.lastExpandedID
+	}
+}
+
+// duplicateID See the ref. at idAssigner interface
+func (ids *sequentialIDs) duplicateID(parent, original EdgeID) EdgeID {
+	ids.lastEdgeID++
+	return ids.lastEdgeID
+}
+
+// expandedEdgeID See the ref. at idAssigner interface
+func (ids *sequentialIDs) expandedEdgeID(source, target EdgeID) int64 {
+	ids.lastExpandedID++
+	return ids.lastExpandedID
+}
+
+// stableIDs Derives identifiers from hashes of keys. Identifiers which are known by mapping are reused
+/*
+	Hash collisions are resolved by probing of the next values, so order of objects matters in that case only.
+	Identifiers of edges and duplicated vertices share the same space since both are vertices of expanded graph
+*/
+type stableIDs struct {
+	mapping      *IDMapping
+	usedVertices map[EdgeID]bool
+	usedExpanded map[int64]bool
+}
+
+// newStableIDs Creates generator which reuses and updates given mapping
+func newStableIDs(mapping *IDMapping) *stableIDs {
+	ids := &stableIDs{
+		mapping:      mapping,
+		usedVertices: make(map[EdgeID]bool, len(mapping.Edges)+len(mapping.Duplicates)),
+		usedExpanded: make(map[int64]bool, len(mapping.ExpandedEdges)),
+	}
+	for _, id := range mapping.Edges {
+		ids.usedVertices[id] = true
+	}
+	for _, id := range mapping.Duplicates {
+		ids.usedVertices[id] = true
+	}
+	for _, id := range mapping.ExpandedEdges {
+		ids.usedExpanded[id] = true
+	}
+	return ids
+}
+
+// assignEdges See the ref. at idAssigner interface
+/*
+	Known segments are processed first, so new segments can't take their identifiers.
+	Segment which is met several times (self-overlapping way) gets new identifier for every repeat, and repeats are not stored in mapping
+*/
+func (ids *stableIDs) assignEdges(edges []Edge) {
+	assigned := make(map[SegmentKey]bool, len(edges))
+	for i := range edges {
+		key := edges[i].segmentKey()
+		if id, ok := ids.mapping.Edges[key]; ok && !assigned[key] {
+			edges[i].ID = id
+			assigned[key] = true
+		} else {
+			edges[i].ID = 0
+		}
+	}
+	for i := range edges {
+		if edges[i].ID != 0 {
+			continue
+		}
+		key := edges[i].segmentKey()
+		id := EdgeID(ids.probe(hashKey(1, int64(key.WayID), int64(key.SourceNodeID), int64(key.TargetNodeID)), func(id int64) bool {
+			return ids.usedVertices[EdgeID(id)]
+		}))
+		ids.usedVertices[id] = true
+		edges[i].ID = id
+		if !assigned[key] {
+			ids.mapping.Edges[key] = id
+			assigned[key] = true
+		}
+	}
+}
+
+// assignExpandedEdges See the ref. at idAssigner interface
+func (ids *stableIDs) assignExpandedEdges(expandedEdges []ExpandedEdge) {
+	for i := range expandedEdges {
+		if id, ok := ids.mapping.ExpandedEdges[TurnKey{expandedEdges[i].Source, expandedEdges[i].Target}]; ok {
+			expandedEdges[i].ID = id
+		} else {
+			expandedEdges[i].ID = 0
+		}
+	}
+	for i := range expandedEdges {
+		if expandedEdges[i].ID == 0 {
+			expandedEdges[i].ID = ids.expandedEdgeID(expandedEdges[i].Source, expandedEdges[i].Target)
+		}
+	}
+}
+
+// duplicateID See the ref. at idAssigner interface
+func (ids *stableIDs) duplicateID(parent, original EdgeID) EdgeID {
+	key := DuplicateKey{parent, original}
+	if id, ok := ids.mapping.Duplicates[key]; ok {
+		return id
+	}
+	id := EdgeID(ids.probe(hashKey(2, int64(parent), int64(original)), func(id int64) bool {
+		return ids.usedVertices[EdgeID(id)]
+	}))
+	ids.usedVertices[id] = true
+	ids.mapping.Duplicates[key] = id
+	return id
+}
+
+// expandedEdgeID See the ref. at idAssigner interface
+func (ids *stableIDs) expandedEdgeID(source, target EdgeID) int64 {
+	key := TurnKey{source, target}
+	if id, ok := ids.mapping.ExpandedEdges[key]; ok {
+		return id
+	}
+	id := ids.probe(hashKey(3, int64(source), int64(target)), func(id int64) bool {
+		return ids.usedExpanded[id]
+	})
+	ids.usedExpanded[id] = true
+	ids.mapping.ExpandedEdges[key] = id
+	return id
+}
+
+// probe Returns the first unused value starting from given one. Zero is never returned
+func (ids *stableIDs) probe(id int64, used func(int64) bool) int64 {
+	for id == 0 || used(id) {
+		id = (id + 1) & stableIDMask
+	}
+	return id
+}
+
+// hashKey Returns FNV-1a hash of kind of object and its key values truncated to the range of stable identifiers
+func hashKey(kind byte, values ...int64) int64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	h.Write([]byte{kind})
+	for _, v := range values {
+		binary.LittleEndian.PutUint64(buf, uint64(v))
+		h.Write(buf)
+	}
+	return int64(h.Sum64() & stableIDMask)
+}
+
+// segmentKey Returns key of edge for stable identifiers
+func (edge *Edge) segmentKey() SegmentKey {
+	return SegmentKey{WayID: edge.WayID, SourceNodeID: edge.SourceNodeID, TargetNodeID: edge.TargetNodeID}
+}
@@ -0,0 +1,82 @@
+package osm2ch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStableIDs(t *testing.T) {
+	edges := []Edge{
+		{WayID: 1, SourceNodeID: 1, TargetNodeID: 2},
+		{WayID: 1, SourceNodeID: 2, TargetNodeID: 1},
+		{WayID: 2, SourceNodeID: 2, TargetNodeID: 3},
+	}
+	first := newStableIDs(NewIDMapping())
+	first.assignEdges(edges)
+	known := map[SegmentKey]EdgeID{}
+	for _, edge := range edges {
+		if edge.ID <= 0 {
+			t.Errorf("Identifier of edge %v should be positive, but got %d", edge.segmentKey(), edge.ID)
+		}
+		known[edge.segmentKey()] = edge.ID
+	}
+	if len(known) != len(edges) {
+		t.Errorf("Identifiers of edges should be unique")
+	}
+
+	// Fresher extract: new segment appears before known ones, one segment is removed
+	dir, err := ioutil.TempDir("", "osm2ch-ids")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "ids.gob")
+	if err := first.mapping.Save(fileName); err != nil {
+		t.Error(err)
+		return
+	}
+	mapping, err := LoadIDMapping(fileName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	updated := []Edge{
+		{WayID: 3, SourceNodeID: 3, TargetNodeID: 4},
+		{WayID: 2, SourceNodeID: 2, TargetNodeID: 3},
+		{WayID: 1, SourceNodeID: 1, TargetNodeID: 2},
+	}
+	second := newStableIDs(mapping)
+	second.assignEdges(updated)
+	for _, edge := range updated[1:] {
+		if edge.ID != known[edge.segmentKey()] {
+			t.Errorf("Identifier of unchanged edge %v should be %d, but got %d", edge.segmentKey(), known[edge.segmentKey()], edge.ID)
+		}
+	}
+	for _, id := range known {
+		if updated[0].ID == id {
+			t.Errorf("Identifier %d of new edge should not reuse identifier of known edge", id)
+		}
+	}
+
+	// Expanded edges depend on identifiers of edges only
+	expandedEdges := []ExpandedEdge{{Source: updated[2].ID, Target: updated[1].ID}}
+	second.assignExpandedEdges(expandedEdges)
+	if id := newStableIDs(NewIDMapping()).expandedEdgeID(updated[2].ID, updated[1].ID); id != expandedEdges[0].ID {
+		t.Errorf("Identifier of expanded edge should be %d, but got %d", id, expandedEdges[0].ID)
+	}
+}
+
+func TestStableIDsCollision(t *testing.T) {
+	ids := newStableIDs(NewIDMapping())
+	id := hashKey(1, 1, 1, 2)
+	// Identifier is taken by another vertex already
+	ids.usedVertices[EdgeID(id)] = true
+	edges := []Edge{{WayID: 1, SourceNodeID: 1, TargetNodeID: 2}}
+	ids.assignEdges(edges)
+	if edges[0].ID != EdgeID(id+1) {
+		t.Errorf("Identifier should be probed to %d, but got %d", id+1, edges[0].ID)
+	}
+}
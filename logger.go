@@ -0,0 +1,187 @@
+package osm2ch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Logger Receives progress of import. Library doesn't write anything unless logger is set in configuration
+/*
+	Stages are identified by short names: 'ways', 'nodes', 'relations' (scanning of OSM data), 'changes', 'preparing', 'comparing'
+	(applying of OSM change file), 'clipping', 'counting', 'edges', 'vertices', 'node_based', 'expanding' and 'restrictions' (building of graph).
+	Methods are called from the goroutine which runs import
+*/
+type Logger interface {
+	// StageStarted Is called when stage starts
+	StageStarted(stage string)
+	// StageFinished Is called when stage is done. Counters describe results of stage (e.g. number of ways or ignored cycles)
+	StageFinished(stage string, elapsed time.Duration, counters []Counter)
+	// Progress Is called during scanning of OSM data when percentage of processed data grows. Percent is in range [0, 100]
+	Progress(stage string, percent float64)
+}
+
+// Counter Named result of stage
+type Counter struct {
+	Name  string
+	Value int
+}
+
+// stageTitles Human readable descriptions of stages for text logger
+var stageTitles = map[string]string{
+	"ways":         "Scanning ways",
+	"nodes":        "Scanning nodes",
+	"relations":    "Scanning maneuvers (restrictions)",
+	"changes":      "Reading changes",
+	"preparing":    "Preparing ways",
+	"comparing":    "Comparing edges with previous build",
+	"clipping":     "Clipping ways",
+	"counting":     "Counting node use cases",
+	"edges":        "Preparing edges",
+	"vertices":     "Preparing nodes",
+	"node_based":   "Preparing node based graph (edge expanding technique and restrictions are skipped)",
+	"expanding":    "Applying edge expanding technique",
+	"restrictions": "Working with maneuvers (restrictions)",
+	// Stages of command line tool
+	"contraction": "Preparing contraction hierarchies",
+	"output":      "Writing output files",
+}
+
+// stageTitle Returns description of stage
+func stageTitle(stage string) string {
+	if title, ok := stageTitles[stage]; ok {
+		return title
+	}
+	return stage
+}
+
+// textLogger Writes events as human readable lines
+type textLogger struct {
+	sync.Mutex
+	w        io.Writer
+	progress bool
+}
+
+// NewTextLogger Creates logger which writes human readable lines to given writer. Progress is written only in verbose mode
+func NewTextLogger(w io.Writer, verbose bool) Logger {
+	return &textLogger{w: w, progress: verbose}
+}
+
+// StageStarted See the ref. at Logger interface
+func (logger *textLogger) StageStarted(stage string) {
+	logger.Lock()
+	defer logger.Unlock()
+	fmt.Fprintf(logger.w, "%s...\n", stageTitle(stage))
+}
+
+// StageFinished See the ref. at Logger interface
+func (logger *textLogger) StageFinished(stage string, elapsed time.Duration, counters []Counter) {
+	logger.Lock()
+	defer logger.Unlock()
+	fmt.Fprintf(logger.w, "Done in %v\n", elapsed)
+	for _, counter := range counters {
+		fmt.Fprintf(logger.w, "\t%s: %d\n", counter.Name, counter.Value)
+	}
+}
+
+// Progress See the ref. at Logger interface
+func (logger *textLogger) Progress(stage string, percent float64) {
+	if !logger.progress {
+		return
+	}
+	logger.Lock()
+	defer logger.Unlock()
+	fmt.Fprintf(logger.w, "\t%s: %.0f%%\n", stageTitle(stage), percent)
+}
+
+// jsonLogger Writes events as JSON objects (one per line)
+type jsonLogger struct {
+	sync.Mutex
+	encoder  *json.Encoder
+	progress bool
+}
+
+// jsonEvent JSON representation of event
+type jsonEvent struct {
+	Time      string         `json:"time"`
+	Event     string         `json:"event"`
+	Stage     string         `json:"stage"`
+	ElapsedMs *float64       `json:"elapsed_ms,omitempty"`
+	Percent   *float64       `json:"percent,omitempty"`
+	Counters  map[string]int `json:"counters,omitempty"`
+}
+
+// NewJSONLogger Creates logger which writes events as JSON objects (one per line) to given writer. Progress is written only in verbose mode
+/*
+	Every object has fields 'time' (RFC 3339), 'event' ('stage_started', 'stage_finished' or 'progress') and 'stage'.
+	Finished stages have 'elapsed_ms' and 'counters' fields, progress events have 'percent' field
+*/
+func NewJSONLogger(w io.Writer, verbose bool) Logger {
+	return &jsonLogger{encoder: json.NewEncoder(w), progress: verbose}
+}
+
+// StageStarted See the ref. at Logger interface
+func (logger *jsonLogger) StageStarted(stage string) {
+	logger.write(jsonEvent{Event: "stage_started", Stage: stage})
+}
+
+// StageFinished See the ref. at Logger interface
+func (logger *jsonLogger) StageFinished(stage string, elapsed time.Duration, counters []Counter) {
+	elapsedMs := float64(elapsed) / float64(time.Millisecond)
+	event := jsonEvent{Event: "stage_finished", Stage: stage, ElapsedMs: &elapsedMs}
+	if len(counters) != 0 {
+		event.Counters = make(map[string]int, len(counters))
+		for _, counter := range counters {
+			event.Counters[counter.Name] = counter.Value
+		}
+	}
+	logger.write(event)
+}
+
+// Progress See the ref. at Logger interface
+func (logger *jsonLogger) Progress(stage string, percent float64) {
+	if !logger.progress {
+		return
+	}
+	logger.write(jsonEvent{Event: "progress", Stage: stage, Percent: &percent})
+}
+
+// write Encodes event. Errors of writer are ignored: logging shouldn't break import
+func (logger *jsonLogger) write(event jsonEvent) {
+	logger.Lock()
+	defer logger.Unlock()
+	event.Time = time.Now().Format(time.RFC3339Nano)
+	logger.encoder.Encode(event)
+}
+
+// nopLogger Discards every event
+type nopLogger struct{}
+
+// StageStarted See the ref. at Logger interface
+func (nopLogger) StageStarted(stage string) {}
+
+// StageFinished See the ref. at Logger interface
+func (nopLogger) StageFinished(stage string, elapsed time.Duration, counters []Counter) {}
+
+// Progress See the ref. at Logger interface
+func (nopLogger) Progress(stage string, percent float64) {}
+
+// stageTimer Measures duration of stage and reports its start and finish to logger
+type stageTimer struct {
+	logger Logger
+	stage  string
+	start  time.Time
+}
+
+// startStage Reports start of stage to logger
+func startStage(logger Logger, stage string) *stageTimer {
+	logger.StageStarted(stage)
+	return &stageTimer{logger: logger, stage: stage, start: time.Now()}
+}
+
+// finish Reports finish of stage with its results to logger
+func (timer *stageTimer) finish(counters ...Counter) {
+	timer.logger.StageFinished(timer.stage, time.Since(timer.start), counters)
+}
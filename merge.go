@@ -0,0 +1,146 @@
+package osm2ch
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// objectVersions The highest versions of OSM objects (of the same type) which have been met in several sources
+type objectVersions map[int64]int
+
+// newer Checks if object should replace previously met one with the same ID. Remembers version of accepted object.
+// Nil map accepts every object (single source has no duplicates)
+func (versions objectVersions) newer(id int64, version int) bool {
+	if versions == nil {
+		return true
+	}
+	if previous, ok := versions[id]; ok && previous >= version {
+		return false
+	}
+	versions[id] = version
+	return true
+}
+
+// scanSources Passes every OSM object of every source to handler. Sources are seeked to the start before scanning
+/*
+	Stage is used for CancelledError, error messages and progress events of logger.
+	Progress is measured by bytes which have been read from sources
+*/
+func scanSources(ctx context.Context, sources []io.ReadSeeker, formats []InputFormat, procs int, stage string, logger Logger, handle func(obj osm.Object) error) error {
+	sizes := make([]int64, len(sources))
+	progress := &scanProgress{logger: logger, stage: stage}
+	for i, r := range sources {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return errors.Wrapf(err, "Can't seek source #%d to end before scanning %s", i+1, stage)
+		}
+		sizes[i] = size
+		progress.total += size
+	}
+	offset := int64(0)
+	for i, r := range sources {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrapf(err, "Can't seek source #%d to start before scanning %s", i+1, stage)
+		}
+		counter := &countingReader{r: r}
+		scanner, err := newScanner(ctx, counter, formats[i], procs)
+		if err != nil {
+			return err
+		}
+		objects := 0
+		for scanner.Scan() {
+			if err := handle(scanner.Object()); err != nil {
+				scanner.Close()
+				return err
+			}
+			objects++
+			if objects%progressInterval == 0 {
+				progress.report(offset + counter.count())
+			}
+		}
+		scanErr := scanner.Err()
+		scanner.Close()
+		// Scanner could stop without error when it is interrupted, so context should be checked explicitly
+		if err := checkCancelled(ctx, stage); err != nil {
+			return err
+		}
+		if scanErr != nil {
+			return &ParseError{Stage: stage, Err: errors.Wrapf(scanErr, "Scanner error (source #%d)", i+1)}
+		}
+		offset += sizes[i]
+		progress.report(offset)
+	}
+	return nil
+}
+
+const (
+	// Number of scanned objects between checks of progress
+	progressInterval = 1 << 14
+)
+
+// countingReader Counts bytes which have been read. Decoder reads data in its own goroutine, so counter is atomic
+type countingReader struct {
+	n int64
+	r io.Reader
+}
+
+// Read See the ref. at io.Reader interface
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.r.Read(p)
+	atomic.AddInt64(&reader.n, int64(n))
+	return n, err
+}
+
+// count Returns number of bytes which have been read
+func (reader *countingReader) count() int64 {
+	return atomic.LoadInt64(&reader.n)
+}
+
+// scanProgress Reports percentage of scanned data to logger. Every whole percent is reported once
+type scanProgress struct {
+	logger   Logger
+	stage    string
+	total    int64
+	reported int64
+}
+
+// report Reports progress if percentage has grown since previous report
+func (progress *scanProgress) report(processed int64) {
+	if progress.total <= 0 {
+		return
+	}
+	percent := processed * 100 / progress.total
+	if percent > 100 {
+		percent = 100
+	}
+	if percent > progress.reported {
+		progress.reported = percent
+		progress.logger.Progress(progress.stage, float64(percent))
+	}
+}
+
+// compactWays Removes ways which have been superseded by newer versions (they have no nodes)
+func compactWays(ways []Way) []Way {
+	result := ways[:0]
+	for _, way := range ways {
+		if len(way.Nodes) != 0 {
+			result = append(result, way)
+		}
+	}
+	return result
+}
+
+// compactRestrictions Removes restrictions which have been superseded by newer versions (they have zero ID)
+func compactRestrictions(restrictions []restriction) []restriction {
+	result := restrictions[:0]
+	for _, r := range restrictions {
+		if r.ID != 0 {
+			result = append(result, r)
+		}
+	}
+	return result
+}
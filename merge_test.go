@@ -0,0 +1,64 @@
+package osm2ch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestImportGraphFromOSMFiles(t *testing.T) {
+	graph, err := ImportGraphFromOSMFiles([]string{"testdata/crossroad_west.osm", "testdata/crossroad_east.osm"}, &OsmConfiguration{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Merged graph should be the same as graph of the whole crossroad
+	if len(graph.Edges) != 8 {
+		t.Errorf("Number of edges should be %d, but got %d", 8, len(graph.Edges))
+	}
+	if len(graph.ExpandedEdges) != 11 {
+		t.Errorf("Number of expanded edges should be %d, but got %d", 11, len(graph.ExpandedEdges))
+	}
+}
+
+func TestImportAllVersions(t *testing.T) {
+	// Newer version of way 201 is under construction, so it should be excluded
+	newer := []byte(`<osm version="0.6">
+  <way id="201" version="2">
+    <nd ref="4"/>
+    <nd ref="1"/>
+    <tag k="highway" v="construction"/>
+  </way>
+</osm>`)
+	older := []byte(`<osm version="0.6">
+  <way id="202" version="0">
+    <nd ref="1"/>
+    <nd ref="2"/>
+    <tag k="highway" v="residential"/>
+  </way>
+</osm>`)
+	data, err := ioutil.ReadFile("testdata/crossroad.osm")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sources := []io.ReadSeeker{bytes.NewReader(data), bytes.NewReader(newer), bytes.NewReader(older)}
+	graph, err := ImportAll(context.Background(), sources, &OsmConfiguration{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, edge := range graph.Edges {
+		if edge.WayID == 201 {
+			t.Errorf("Way 201 should be replaced by newer version which is not routable")
+		}
+		if edge.WayID == 202 && (edge.SourceNodeID == 2 || edge.TargetNodeID == 2) {
+			t.Errorf("Way 202 should not be replaced by older version")
+		}
+	}
+	if len(graph.Edges) != 6 {
+		t.Errorf("Number of edges should be %d, but got %d", 6, len(graph.Edges))
+	}
+}
@@ -1,11 +1,208 @@
 package osm2ch
 
 import (
+	"math/bits"
+	"sort"
+
 	"github.com/paulmach/osm"
 )
 
-type Node struct {
-	ID       osm.NodeID
-	useCount int
-	node     osm.Node
+// nodeRefs Sorted set of nodes which are referenced by ways. Keeps number of use cases of every node
+type nodeRefs struct {
+	ids []osm.NodeID
+	// Number of use cases of node: endpoints of ways (and nodes with penalties) are counted twice
+	useCounts []int32
+	// Is node presented in OSM data?
+	found []bool
+}
+
+// newNodeRefs Prepares set of nodes from given IDs (duplicates are allowed). Given slice is reused
+func newNodeRefs(ids []osm.NodeID) *nodeRefs {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	unique := ids[:0]
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return &nodeRefs{
+		ids:       unique,
+		useCounts: make([]int32, len(unique)),
+		found:     make([]bool, len(unique)),
+	}
+}
+
+// index Returns index of node in set. Returns -1 if node is not referenced
+func (refs *nodeRefs) index(id osm.NodeID) int {
+	idx := sort.Search(len(refs.ids), func(i int) bool {
+		return refs.ids[i] >= id
+	})
+	if idx < len(refs.ids) && refs.ids[idx] == id {
+		return idx
+	}
+	return -1
+}
+
+// extend Returns set with additional nodes which are not part of OSM data (so they are marked as found). Use cases of nodes are kept
+func (refs *nodeRefs) extend(ids []osm.NodeID) *nodeRefs {
+	extended := &nodeRefs{
+		ids:       make([]osm.NodeID, 0, len(refs.ids)+len(ids)),
+		useCounts: make([]int32, 0, len(refs.ids)+len(ids)),
+		found:     make([]bool, 0, len(refs.ids)+len(ids)),
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	i, j := 0, 0
+	for i < len(refs.ids) || j < len(ids) {
+		if j == len(ids) || (i < len(refs.ids) && refs.ids[i] <= ids[j]) {
+			if j < len(ids) && refs.ids[i] == ids[j] {
+				j++
+			}
+			extended.ids = append(extended.ids, refs.ids[i])
+			extended.useCounts = append(extended.useCounts, refs.useCounts[i])
+			extended.found = append(extended.found, refs.found[i])
+			i++
+			continue
+		}
+		extended.ids = append(extended.ids, ids[j])
+		extended.useCounts = append(extended.useCounts, 0)
+		extended.found = append(extended.found, true)
+		j++
+	}
+	return extended
+}
+
+const (
+	// Number of identifiers in single chunk of nodeSet (identifiers of chunk share high bits)
+	nodeChunkBits = 16
+	// Sparse chunk with more elements than that becomes bitmap (both take 8 KB then)
+	nodeChunkArrayLimit = 4096
+)
+
+// nodeSet Compressed set of node identifiers which is filled while ways are scanned, so duplicated references are not kept
+/*
+	Identifiers are split into chunks by their high bits (the same way as in roaring bitmaps). Sparse chunks are kept
+	as sorted arrays of low bits, dense ones are kept as bitmaps, so every node takes 2 bytes at most
+*/
+type nodeSet struct {
+	chunks map[int64]*nodeChunk
+}
+
+// nodeChunk Low bits of identifiers which share high bits. Either array or bitmap is used
+type nodeChunk struct {
+	array  []uint16
+	bitmap []uint64
+}
+
+// newNodeSet Creates empty set
+func newNodeSet() *nodeSet {
+	return &nodeSet{chunks: make(map[int64]*nodeChunk)}
+}
+
+// add Puts node into set
+func (set *nodeSet) add(id osm.NodeID) {
+	high, low := int64(id)>>nodeChunkBits, uint16(id)
+	chunk, ok := set.chunks[high]
+	if !ok {
+		chunk = &nodeChunk{}
+		set.chunks[high] = chunk
+	}
+	if chunk.bitmap != nil {
+		chunk.bitmap[low/64] |= 1 << (low % 64)
+		return
+	}
+	idx := sort.Search(len(chunk.array), func(i int) bool {
+		return chunk.array[i] >= low
+	})
+	if idx < len(chunk.array) && chunk.array[idx] == low {
+		return
+	}
+	if len(chunk.array) < nodeChunkArrayLimit {
+		chunk.array = append(chunk.array, 0)
+		copy(chunk.array[idx+1:], chunk.array[idx:])
+		chunk.array[idx] = low
+		return
+	}
+	chunk.bitmap = make([]uint64, (1<<nodeChunkBits)/64)
+	for _, v := range chunk.array {
+		chunk.bitmap[v/64] |= 1 << (v % 64)
+	}
+	chunk.bitmap[low/64] |= 1 << (low % 64)
+	chunk.array = nil
+}
+
+// contains Checks if node is in set
+func (set *nodeSet) contains(id osm.NodeID) bool {
+	chunk, ok := set.chunks[int64(id)>>nodeChunkBits]
+	if !ok {
+		return false
+	}
+	low := uint16(id)
+	if chunk.bitmap != nil {
+		return chunk.bitmap[low/64]&(1<<(low%64)) != 0
+	}
+	idx := sort.Search(len(chunk.array), func(i int) bool {
+		return chunk.array[i] >= low
+	})
+	return idx < len(chunk.array) && chunk.array[idx] == low
+}
+
+// sorted Returns identifiers of nodes in ascending order
+func (set *nodeSet) sorted() []osm.NodeID {
+	highs := make([]int64, 0, len(set.chunks))
+	size := 0
+	for high, chunk := range set.chunks {
+		highs = append(highs, high)
+		if chunk.bitmap != nil {
+			for _, word := range chunk.bitmap {
+				size += bits.OnesCount64(word)
+			}
+		} else {
+			size += len(chunk.array)
+		}
+	}
+	sort.Slice(highs, func(i, j int) bool {
+		return highs[i] < highs[j]
+	})
+	ids := make([]osm.NodeID, 0, size)
+	for _, high := range highs {
+		chunk := set.chunks[high]
+		base := high << nodeChunkBits
+		if chunk.bitmap == nil {
+			for _, low := range chunk.array {
+				ids = append(ids, osm.NodeID(base|int64(low)))
+			}
+			continue
+		}
+		for i, word := range chunk.bitmap {
+			for word != 0 {
+				bit := bits.TrailingZeros64(word)
+				ids = append(ids, osm.NodeID(base|int64(i*64+bit)))
+				word &= word - 1
+			}
+		}
+	}
+	return ids
+}
+
+// nodeCost Cost of passing through the node (traffic signals, stop signs, barriers and etc.)
+type nodeCost struct {
+	// Time penalty (seconds)
+	seconds float64
+	// Node can't be passed at all
+	blocked bool
+}
+
+// significant Checks if node affects routing, so it should become vertex of graph
+func (cost nodeCost) significant() bool {
+	return cost.seconds > 0 || cost.blocked
+}
+
+// nodeCost Evaluates cost of passing through the node with given tags
+func (cfg *OsmConfiguration) nodeCost(tags osm.Tags, profile Profile) nodeCost {
+	seconds, passable := profile.NodePenalty(cfg.resolveTags(tags))
+	return nodeCost{seconds: seconds, blocked: !passable}
 }
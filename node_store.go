@@ -0,0 +1,196 @@
+package osm2ch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+const (
+	// Coordinates are stored as fixed-point numbers with 7 decimal digits (the same precision as in OSM database)
+	coordinatePrecision = 1e7
+)
+
+// NodeStore Storage for coordinates of nodes which are referenced by ways
+/*
+	Import puts coordinates of all needed nodes (in any order) and then calls Seal once.
+	After that only Get calls are done (concurrently, from several workers). Store is closed by import.
+*/
+type NodeStore interface {
+	// Put Stores coordinates of node. If node is put several times then the last coordinates win
+	Put(id osm.NodeID, pt GeoPoint) error
+	// Seal Finishes loading of nodes. Store becomes read-only
+	Seal() error
+	// Get Returns coordinates of node. Returns false if node is missing
+	Get(id osm.NodeID) (GeoPoint, bool)
+	// Close Releases resources of store (memory, temporary files and etc.)
+	Close() error
+}
+
+// NodeStoreFactory Creates empty store for import
+type NodeStoreFactory func() (NodeStore, error)
+
+// NodeStoreFactoryByName Returns factory of store by its name. Supported names are:
+/*
+	'map' - in-memory hash map with full precision of coordinates. Fast, but the most memory consuming;
+	'compact' - in-memory sorted array of IDs and packed fixed-point coordinates (16 bytes per node);
+	'mmap' - the same as 'compact', but array is kept in memory-mapped temporary file in given directory (system temporary directory if it is empty)
+*/
+func NodeStoreFactoryByName(name string, dir string) (NodeStoreFactory, error) {
+	switch strings.ToLower(name) {
+	case "map", "":
+		return func() (NodeStore, error) { return NewMapNodeStore(), nil }, nil
+	case "compact":
+		return func() (NodeStore, error) { return NewCompactNodeStore(), nil }, nil
+	case "mmap":
+		return func() (NodeStore, error) { return NewMmapNodeStore(dir) }, nil
+	default:
+		return nil, fmt.Errorf("Unknown node store: '%s'", name)
+	}
+}
+
+// mapNodeStore Implementation of NodeStore based on hash map
+type mapNodeStore struct {
+	nodes map[osm.NodeID]GeoPoint
+}
+
+// NewMapNodeStore Returns in-memory store based on hash map
+func NewMapNodeStore() NodeStore {
+	return &mapNodeStore{
+		nodes: make(map[osm.NodeID]GeoPoint),
+	}
+}
+
+// Put See the ref. at NodeStore interface
+func (store *mapNodeStore) Put(id osm.NodeID, pt GeoPoint) error {
+	store.nodes[id] = pt
+	return nil
+}
+
+// Seal See the ref. at NodeStore interface
+func (store *mapNodeStore) Seal() error {
+	return nil
+}
+
+// Get See the ref. at NodeStore interface
+func (store *mapNodeStore) Get(id osm.NodeID) (GeoPoint, bool) {
+	pt, ok := store.nodes[id]
+	return pt, ok
+}
+
+// Close See the ref. at NodeStore interface
+func (store *mapNodeStore) Close() error {
+	store.nodes = nil
+	return nil
+}
+
+// overlayNodeStore Read-only view of sealed store with additional nodes which are not part of OSM data (e.g. nodes on boundary of clipping area)
+type overlayNodeStore struct {
+	NodeStore
+	extra map[osm.NodeID]GeoPoint
+}
+
+// Get See the ref. at NodeStore interface
+func (store overlayNodeStore) Get(id osm.NodeID) (GeoPoint, bool) {
+	if pt, ok := store.extra[id]; ok {
+		return pt, true
+	}
+	return store.NodeStore.Get(id)
+}
+
+// compactNodeStore Implementation of NodeStore based on sorted array of IDs and packed fixed-point coordinates
+type compactNodeStore struct {
+	ids    []osm.NodeID
+	coords []int32 // Pairs of latitude and longitude
+	sorted bool
+	sealed bool
+}
+
+// NewCompactNodeStore Returns in-memory store based on sorted arrays
+func NewCompactNodeStore() NodeStore {
+	return &compactNodeStore{sorted: true}
+}
+
+// Put See the ref. at NodeStore interface
+func (store *compactNodeStore) Put(id osm.NodeID, pt GeoPoint) error {
+	if store.sealed {
+		return fmt.Errorf("Can't put node %d: store is sealed", id)
+	}
+	// Nodes in PBF files are sorted by ID usually, so sorting could be skipped
+	if len(store.ids) != 0 && store.ids[len(store.ids)-1] >= id {
+		store.sorted = false
+	}
+	store.ids = append(store.ids, id)
+	store.coords = append(store.coords, toFixedPoint(pt.Lat), toFixedPoint(pt.Lon))
+	return nil
+}
+
+// Seal See the ref. at NodeStore interface
+func (store *compactNodeStore) Seal() error {
+	store.sealed = true
+	if store.sorted {
+		return nil
+	}
+	// Stable sort keeps order of duplicates, so the last put coordinates could be taken
+	sort.Stable(store)
+	n := 0
+	for i := range store.ids {
+		if i+1 < len(store.ids) && store.ids[i+1] == store.ids[i] {
+			continue
+		}
+		store.ids[n] = store.ids[i]
+		store.coords[2*n], store.coords[2*n+1] = store.coords[2*i], store.coords[2*i+1]
+		n++
+	}
+	store.ids = store.ids[:n]
+	store.coords = store.coords[:2*n]
+	store.sorted = true
+	return nil
+}
+
+// Get See the ref. at NodeStore interface
+func (store *compactNodeStore) Get(id osm.NodeID) (GeoPoint, bool) {
+	idx := sort.Search(len(store.ids), func(i int) bool {
+		return store.ids[i] >= id
+	})
+	if idx >= len(store.ids) || store.ids[idx] != id {
+		return GeoPoint{}, false
+	}
+	return GeoPoint{Lat: fromFixedPoint(store.coords[2*idx]), Lon: fromFixedPoint(store.coords[2*idx+1])}, true
+}
+
+// Close See the ref. at NodeStore interface
+func (store *compactNodeStore) Close() error {
+	store.ids, store.coords = nil, nil
+	return nil
+}
+
+// Len See the ref. at sort.Interface
+func (store *compactNodeStore) Len() int {
+	return len(store.ids)
+}
+
+// Less See the ref. at sort.Interface
+func (store *compactNodeStore) Less(i, j int) bool {
+	return store.ids[i] < store.ids[j]
+}
+
+// Swap See the ref. at sort.Interface
+func (store *compactNodeStore) Swap(i, j int) {
+	store.ids[i], store.ids[j] = store.ids[j], store.ids[i]
+	store.coords[2*i], store.coords[2*j] = store.coords[2*j], store.coords[2*i]
+	store.coords[2*i+1], store.coords[2*j+1] = store.coords[2*j+1], store.coords[2*i+1]
+}
+
+// toFixedPoint Converts coordinate to fixed-point number
+func toFixedPoint(v float64) int32 {
+	return int32(math.Round(v * coordinatePrecision))
+}
+
+// fromFixedPoint Converts fixed-point number to coordinate
+func fromFixedPoint(v int32) float64 {
+	return float64(v) / coordinatePrecision
+}
@@ -0,0 +1,157 @@
+//go:build unix
+// +build unix
+
+package osm2ch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"syscall"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Record of node: ID (int64), latitude and longitude (int32 fixed-point numbers)
+	mmapRecordSize = 16
+)
+
+// mmapNodeStore Implementation of NodeStore based on sorted array of records in memory-mapped temporary file
+type mmapNodeStore struct {
+	file   *os.File
+	writer *bufio.Writer
+	data   []byte
+	count  int
+	lastID osm.NodeID
+	sorted bool
+}
+
+// NewMmapNodeStore Returns store which keeps nodes in memory-mapped temporary file in given directory (system temporary directory if it is empty)
+func NewMmapNodeStore(dir string) (NodeStore, error) {
+	file, err := ioutil.TempFile(dir, "osm2ch-nodes-*.bin")
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't create file for node store")
+	}
+	return &mmapNodeStore{
+		file:   file,
+		writer: bufio.NewWriterSize(file, 1<<20),
+		sorted: true,
+	}, nil
+}
+
+// Put See the ref. at NodeStore interface
+func (store *mmapNodeStore) Put(id osm.NodeID, pt GeoPoint) error {
+	if store.writer == nil {
+		return fmt.Errorf("Can't put node %d: store is sealed", id)
+	}
+	if store.count != 0 && store.lastID >= id {
+		store.sorted = false
+	}
+	record := [mmapRecordSize]byte{}
+	binary.LittleEndian.PutUint64(record[0:8], uint64(id))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(toFixedPoint(pt.Lat)))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(toFixedPoint(pt.Lon)))
+	if _, err := store.writer.Write(record[:]); err != nil {
+		return errors.Wrap(err, "Can't write node to store")
+	}
+	store.count++
+	store.lastID = id
+	return nil
+}
+
+// Seal See the ref. at NodeStore interface
+func (store *mmapNodeStore) Seal() error {
+	if store.writer == nil {
+		return nil
+	}
+	if err := store.writer.Flush(); err != nil {
+		return errors.Wrap(err, "Can't flush node store")
+	}
+	store.writer = nil
+	if store.count == 0 {
+		return nil
+	}
+	data, err := syscall.Mmap(int(store.file.Fd()), 0, store.count*mmapRecordSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return errors.Wrap(err, "Can't map node store into memory")
+	}
+	store.data = data
+	if store.sorted {
+		return nil
+	}
+	// Stable sort keeps order of duplicates, so the last put coordinates could be taken
+	sort.Stable(store)
+	n := 0
+	for i := 0; i < store.count; i++ {
+		if i+1 < store.count && store.id(i+1) == store.id(i) {
+			continue
+		}
+		copy(store.data[n*mmapRecordSize:(n+1)*mmapRecordSize], store.data[i*mmapRecordSize:(i+1)*mmapRecordSize])
+		n++
+	}
+	store.count = n
+	store.sorted = true
+	return nil
+}
+
+// Get See the ref. at NodeStore interface
+func (store *mmapNodeStore) Get(id osm.NodeID) (GeoPoint, bool) {
+	if store.data == nil {
+		return GeoPoint{}, false
+	}
+	idx := sort.Search(store.count, func(i int) bool {
+		return store.id(i) >= id
+	})
+	if idx >= store.count || store.id(idx) != id {
+		return GeoPoint{}, false
+	}
+	record := store.data[idx*mmapRecordSize : (idx+1)*mmapRecordSize]
+	return GeoPoint{
+		Lat: fromFixedPoint(int32(binary.LittleEndian.Uint32(record[8:12]))),
+		Lon: fromFixedPoint(int32(binary.LittleEndian.Uint32(record[12:16]))),
+	}, true
+}
+
+// Close See the ref. at NodeStore interface
+func (store *mmapNodeStore) Close() error {
+	if store.data != nil {
+		if err := syscall.Munmap(store.data); err != nil {
+			return errors.Wrap(err, "Can't unmap node store")
+		}
+		store.data = nil
+	}
+	if err := store.file.Close(); err != nil {
+		return errors.Wrap(err, "Can't close node store")
+	}
+	return os.Remove(store.file.Name())
+}
+
+// id Returns ID of node in record with given index
+func (store *mmapNodeStore) id(i int) osm.NodeID {
+	return osm.NodeID(binary.LittleEndian.Uint64(store.data[i*mmapRecordSize : i*mmapRecordSize+8]))
+}
+
+// Len See the ref. at sort.Interface
+func (store *mmapNodeStore) Len() int {
+	return store.count
+}
+
+// Less See the ref. at sort.Interface
+func (store *mmapNodeStore) Less(i, j int) bool {
+	return store.id(i) < store.id(j)
+}
+
+// Swap See the ref. at sort.Interface
+func (store *mmapNodeStore) Swap(i, j int) {
+	tmp := [mmapRecordSize]byte{}
+	a := store.data[i*mmapRecordSize : (i+1)*mmapRecordSize]
+	b := store.data[j*mmapRecordSize : (j+1)*mmapRecordSize]
+	copy(tmp[:], a)
+	copy(a, b)
+	copy(b, tmp[:])
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+// +build !unix
+
+package osm2ch
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// NewMmapNodeStore Memory-mapped node store is supported on Unix-like systems only
+func NewMmapNodeStore(dir string) (NodeStore, error) {
+	return nil, fmt.Errorf("Memory-mapped node store is not supported on %s", runtime.GOOS)
+}
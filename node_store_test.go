@@ -0,0 +1,74 @@
+package osm2ch
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestNodeStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osm2ch-test")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	factories := map[string]NodeStoreFactory{}
+	for _, name := range []string{"map", "compact", "mmap"} {
+		if name == "mmap" && runtime.GOOS == "windows" {
+			continue
+		}
+		factory, err := NodeStoreFactoryByName(name, dir)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		factories[name] = factory
+	}
+	// Unsorted IDs with duplicate: the last coordinates should win
+	puts := []struct {
+		id osm.NodeID
+		pt GeoPoint
+	}{
+		{30, GeoPoint{Lon: 37.6417351, Lat: 55.7518494}},
+		{10, GeoPoint{Lon: -75.476596, Lat: 39.724949}},
+		{20, GeoPoint{Lon: 0, Lat: 0}},
+		{10, GeoPoint{Lon: -75.5, Lat: 39.5}},
+	}
+	expected := map[osm.NodeID]GeoPoint{
+		10: {Lon: -75.5, Lat: 39.5},
+		20: {Lon: 0, Lat: 0},
+		30: {Lon: 37.6417351, Lat: 55.7518494},
+	}
+	for name, factory := range factories {
+		store, err := factory()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, put := range puts {
+			if err := store.Put(put.id, put.pt); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := store.Seal(); err != nil {
+			t.Error(err)
+		}
+		for id, pt := range expected {
+			got, ok := store.Get(id)
+			if !ok || math.Abs(got.Lon-pt.Lon) > 1e-7 || math.Abs(got.Lat-pt.Lat) > 1e-7 {
+				t.Errorf("Store '%s': node %d should have coordinates %v, but got %v (found: %t)", name, id, pt, got, ok)
+			}
+		}
+		if _, ok := store.Get(15); ok {
+			t.Errorf("Store '%s': node 15 should be missing", name)
+		}
+		if err := store.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
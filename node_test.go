@@ -0,0 +1,105 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestNodePenalty(t *testing.T) {
+	car := CarProfile()
+	tests := []struct {
+		tags     osm.Tags
+		penalty  float64
+		passable bool
+	}{
+		{osm.Tags{}, 0, true},
+		{osm.Tags{{Key: "highway", Value: "traffic_signals"}}, 15, true},
+		{osm.Tags{{Key: "barrier", Value: "gate"}}, 10, true},
+		{osm.Tags{{Key: "barrier", Value: "bollard"}}, 0, false},
+		{osm.Tags{{Key: "barrier", Value: "bollard"}, {Key: "motor_vehicle", Value: "yes"}}, 0, true},
+		{osm.Tags{{Key: "barrier", Value: "gate"}, {Key: "access", Value: "private"}}, 0, false},
+	}
+	for i, test := range tests {
+		penalty, passable := car.NodePenalty(test.tags)
+		if penalty != test.penalty || passable != test.passable {
+			t.Errorf("Test #%d: expected (%f, %t), got (%f, %t)", i, test.penalty, test.passable, penalty, passable)
+		}
+	}
+	if _, passable := BicycleProfile().NodePenalty(osm.Tags{{Key: "barrier", Value: "bollard"}}); !passable {
+		t.Errorf("Bollard should be passable for bicycles")
+	}
+}
+
+func TestNodeCostsExpanding(t *testing.T) {
+	_, edges := prepareDividedRoad()
+	nodeCosts := map[osm.NodeID]nodeCost{
+		2: {seconds: 15},
+		5: {blocked: true},
+	}
+	expandedEdges, _ := expandEdges(edges, nodeCosts, &OsmConfiguration{})
+	for _, expEdge := range expandedEdges {
+		// Edge 1 is 1->2, edge 5 is 2->5 and edge 3 is 6->5
+		if expEdge.Source == 1 && expEdge.TurnCostSeconds != 15 {
+			t.Errorf("Turn %d->%d: cost should be %f, got %f", expEdge.Source, expEdge.Target, 15.0, expEdge.TurnCostSeconds)
+		}
+		if expEdge.Source == 5 || expEdge.Source == 3 {
+			t.Errorf("Turn %d->%d through blocked node should be removed", expEdge.Source, expEdge.Target)
+		}
+	}
+}
+
+func TestNodeBasedEdges(t *testing.T) {
+	_, edges := prepareDividedRoad()
+	nodeCosts := map[osm.NodeID]nodeCost{
+		2: {seconds: 15},
+		5: {blocked: true},
+	}
+	result := nodeBasedEdges(edges, nodeCosts)
+	// Edge 3 (6->5) and edge 5 (2->5) lead to blocked node
+	if len(result) != len(edges)-2 {
+		t.Errorf("Edges leading to blocked node should be removed: expected %d edges, got %d", len(edges)-2, len(result))
+	}
+	for _, edge := range result {
+		if edge.TargetNodeID == 2 && edge.CostSeconds != 15 {
+			t.Errorf("Edge %d: penalty of target node should be included, got %f", edge.ID, edge.CostSeconds)
+		}
+	}
+}
+
+func TestNodeSet(t *testing.T) {
+	set := newNodeSet()
+	expected := map[osm.NodeID]bool{}
+	add := func(id osm.NodeID) {
+		set.add(id)
+		expected[id] = true
+	}
+	// Sparse chunk, dense chunk (becomes bitmap) and negative identifiers
+	for _, id := range []osm.NodeID{5, 3, 5, 1 << 40, -7, -1, -7} {
+		add(id)
+	}
+	for i := 0; i < 2*nodeChunkArrayLimit; i++ {
+		add(osm.NodeID(1<<20 + i*3))
+		add(osm.NodeID(1<<20 + i*3))
+	}
+	if chunk := set.chunks[(1<<20)>>nodeChunkBits]; chunk.bitmap == nil {
+		t.Errorf("Dense chunk should be kept as bitmap")
+	}
+	ids := set.sorted()
+	if len(ids) != len(expected) {
+		t.Errorf("Set should have %d nodes, but got %d", len(expected), len(ids))
+	}
+	for i, id := range ids {
+		if !expected[id] || !set.contains(id) {
+			t.Errorf("Unexpected node %d", id)
+		}
+		if i > 0 && ids[i-1] >= id {
+			t.Errorf("Nodes should be sorted, but got %d after %d", id, ids[i-1])
+		}
+	}
+	for _, id := range []osm.NodeID{4, -2, 1<<20 + 1, 1<<40 + 1} {
+		if set.contains(id) {
+			t.Errorf("Node %d should not be in set", id)
+		}
+	}
+}
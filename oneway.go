@@ -0,0 +1,90 @@
+package osm2ch
+
+import (
+	"github.com/paulmach/osm"
+)
+
+// parseOneway Returns direction for value of 'oneway' tag. Returns false if value is missing or unknown
+/*
+	See the ref.: https://wiki.openstreetmap.org/wiki/Key:oneway
+	'oneway=alternating' (e.g. single lane under traffic lights) is treated as two-way road
+*/
+func parseOneway(value string) (Direction, bool) {
+	switch value {
+	case "yes", "true", "1":
+		return DirectionForward, true
+	case "-1", "reverse":
+		return DirectionBackward, true
+	case "no", "false", "0", "alternating":
+		return DirectionBoth, true
+	case "reversible":
+		return DirectionNone, true
+	default:
+		return DirectionBoth, false
+	}
+}
+
+// wayDirection Returns allowed directions for way with given tags. Class of way is defined by tag with given key (usually it is 'highway')
+/*
+	Explicit 'oneway' tag has the highest priority. When it is missing then oneway is implied for:
+		* roundabouts ('junction=roundabout' or 'junction=circular');
+		* motorways (e.g. 'highway=motorway').
+*/
+func wayDirection(tags osm.Tags, entityName string) Direction {
+	if direction, ok := parseOneway(tags.Find("oneway")); ok {
+		return direction
+	}
+	switch tags.Find("junction") {
+	case "roundabout", "circular":
+		return DirectionForward
+	}
+	if tags.Find(entityName) == "motorway" {
+		return DirectionForward
+	}
+	return DirectionBoth
+}
+
+// wayDirectionForMode Returns allowed directions for way with given tags for given type of transport
+/*
+	Mode specific tags have the highest priority: 'oneway:bicycle' for bicycles and 'oneway:foot' for pedestrians.
+	Bicycles are allowed to ride against the direction of one way road if there is contraflow cycle lane
+	(e.g. 'cycleway=opposite_lane' or 'cycleway:left:oneway=-1').
+	Pedestrians ignore 'oneway' tag.
+*/
+func wayDirectionForMode(tags osm.Tags, entityName string, mode TransportMode) Direction {
+	switch mode {
+	case TransportModeFoot:
+		if direction, ok := parseOneway(tags.Find("oneway:foot")); ok {
+			return direction
+		}
+		return DirectionBoth
+	case TransportModeBicycle:
+		if direction, ok := parseOneway(tags.Find("oneway:bicycle")); ok {
+			return direction
+		}
+		direction := wayDirection(tags, entityName)
+		if direction.Oneway() && bicycleContraflow(tags) {
+			return DirectionBoth
+		}
+		return direction
+	default:
+		return wayDirection(tags, entityName)
+	}
+}
+
+// bicycleContraflow Checks if tags describe cycle lane (or track) which allows to ride against the direction of one way road
+func bicycleContraflow(tags osm.Tags) bool {
+	for _, key := range []string{"cycleway", "cycleway:left", "cycleway:right", "cycleway:both"} {
+		switch tags.Find(key) {
+		case "opposite", "opposite_lane", "opposite_track", "opposite_share_busway":
+			return true
+		}
+	}
+	for _, key := range []string{"cycleway:left:oneway", "cycleway:right:oneway", "cycleway:both:oneway"} {
+		switch tags.Find(key) {
+		case "no", "-1":
+			return true
+		}
+	}
+	return false
+}
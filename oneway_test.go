@@ -0,0 +1,66 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestWayDirection(t *testing.T) {
+	cases := []struct {
+		tags      osm.Tags
+		direction Direction
+	}{
+		{osm.Tags{{Key: "highway", Value: "primary"}}, DirectionBoth},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "yes"}}, DirectionForward},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "1"}}, DirectionForward},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "-1"}}, DirectionBackward},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "reverse"}}, DirectionBackward},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "reversible"}}, DirectionNone},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "oneway", Value: "alternating"}}, DirectionBoth},
+		{osm.Tags{{Key: "highway", Value: "motorway"}}, DirectionForward},
+		{osm.Tags{{Key: "highway", Value: "motorway"}, {Key: "oneway", Value: "no"}}, DirectionBoth},
+		{osm.Tags{{Key: "highway", Value: "tertiary"}, {Key: "junction", Value: "roundabout"}}, DirectionForward},
+		{osm.Tags{{Key: "highway", Value: "tertiary"}, {Key: "junction", Value: "circular"}}, DirectionForward},
+		{osm.Tags{{Key: "highway", Value: "tertiary"}, {Key: "junction", Value: "roundabout"}, {Key: "oneway", Value: "-1"}}, DirectionBackward},
+	}
+	for _, c := range cases {
+		direction := wayDirection(c.tags, "highway")
+		if direction != c.direction {
+			t.Errorf("Direction for tags %v should be '%s', but got '%s'", c.tags, c.direction, direction)
+		}
+	}
+	// Class of way is defined by key of profile
+	custom := osm.Tags{{Key: "road_class", Value: "motorway"}}
+	if direction := wayDirection(custom, "road_class"); direction != DirectionForward {
+		t.Errorf("Direction for tags %v and key 'road_class' should be '%s', but got '%s'", custom, DirectionForward, direction)
+	}
+	if direction := wayDirection(custom, "highway"); direction != DirectionBoth {
+		t.Errorf("Direction for tags %v and key 'highway' should be '%s', but got '%s'", custom, DirectionBoth, direction)
+	}
+}
+
+func TestWayDirectionForMode(t *testing.T) {
+	oneway := osm.Tags{{Key: "highway", Value: "residential"}, {Key: "oneway", Value: "yes"}}
+	cases := []struct {
+		tags      osm.Tags
+		mode      TransportMode
+		direction Direction
+	}{
+		{oneway, TransportModeCar, DirectionForward},
+		{oneway, TransportModeBicycle, DirectionForward},
+		{oneway, TransportModeFoot, DirectionBoth},
+		{append(oneway, osm.Tag{Key: "oneway:bicycle", Value: "no"}), TransportModeBicycle, DirectionBoth},
+		{append(oneway, osm.Tag{Key: "oneway:bicycle", Value: "no"}), TransportModeCar, DirectionForward},
+		{append(oneway, osm.Tag{Key: "cycleway", Value: "opposite_lane"}), TransportModeBicycle, DirectionBoth},
+		{append(oneway, osm.Tag{Key: "cycleway:left:oneway", Value: "-1"}), TransportModeBicycle, DirectionBoth},
+		{append(oneway, osm.Tag{Key: "cycleway:right", Value: "lane"}), TransportModeBicycle, DirectionForward},
+		{append(oneway, osm.Tag{Key: "oneway:foot", Value: "-1"}), TransportModeFoot, DirectionBackward},
+	}
+	for _, c := range cases {
+		direction := wayDirectionForMode(c.tags, "highway", c.mode)
+		if direction != c.direction {
+			t.Errorf("Direction for tags %v and mode '%s' should be '%s', but got '%s'", c.tags, c.mode, c.direction, direction)
+		}
+	}
+}
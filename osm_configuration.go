@@ -1,9 +1,58 @@
 package osm2ch
 
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	// Default number of goroutines for decoding of PBF blocks
+	defaultDecoderProcs = 4
+)
+
 // OsmConfiguration Allows to filter ways by certain tags from OSM data
 type OsmConfiguration struct {
 	EntityName string // Currrently we support 'highway' only
 	Tags       []string
+	// Routing profile. When it is not set then car profile is used (restricted to Tags if they are provided)
+	Profile Profile
+	// Time penalty (seconds) for moving from one OSM way to another
+	TurnPenalty float64
+	// Time penalties (seconds) for turns depending on turn angle. They are added to TurnPenalty
+	TurnCosts TurnCosts
+	// Treatment of ways which are accessible for reaching destination only ('access=destination', 'motor_vehicle=delivery' and etc.)
+	DestinationAccess DestinationPolicy
+	// Multiplier for travel time along ways with destination access (when DestinationAccess is DestinationPenalize). Default is 2.0
+	DestinationPenalty float64
+	// Moment of time for evaluating conditional tags ('restriction:conditional', 'access:conditional', 'oneway:conditional' and etc.)
+	// in local time of the region. When it is not set then conditional tags are ignored
+	ReferenceTime *time.Time
+	// Type of resulting graph. Default is edge expanded graph
+	Mode GraphMode
+	// Format of input data. By default it is detected by file extension or by content
+	Format InputFormat
+	// Area which road network should be clipped by (BBox or Polygon). When it is not set then whole data is used
+	ClipArea Area
+	// Treatment of ways crossing boundary of ClipArea. Default is keeping whole way
+	ClipPolicy ClipPolicy
+	// Factory of storage for coordinates of nodes. Default is NewMapNodeStore. Use NewCompactNodeStore or NewMmapNodeStore for big extracts
+	NodeStore NodeStoreFactory
+	// Number of goroutines for decoding of PBF blocks. Default is 4
+	DecoderProcs int
+	// Number of goroutines for preparing and expanding edges. Default is number of CPUs. Output doesn't depend on it
+	Workers int
+	// Policy of generating identifiers of edges and expanded edges. Default is sequential numbers
+	IDs IDPolicy
+	// Identifiers assigned during previous builds. When it is set then stable identifiers are used (regardless of IDs field)
+	// and mapping is updated with identifiers of new segments and turns
+	IDMapping *IDMapping
+	// State of the build which should be recorded by import for applying OSM change files later (see the ref. at Update)
+	State *State
+	// Receiver of progress of import. When it is not set then import is silent (see the ref. at NewTextLogger and NewJSONLogger)
+	Logger Logger
+	// Collect diagnostics of every restriction relation: whether it has been applied and why it has been skipped otherwise
+	// (see the ref. at RestrictionReports field of Graph)
+	RestrictionDiagnostics bool
 }
 
 // CheckTag Checks if incoming tag is represented in configuration
@@ -15,3 +64,68 @@ func (cfg *OsmConfiguration) CheckTag(tag string) bool {
 	}
 	return false
 }
+
+// profile Returns routing profile for configuration
+func (cfg *OsmConfiguration) profile() Profile {
+	if cfg.Profile != nil {
+		return cfg.Profile
+	}
+	profile := CarProfile()
+	if len(cfg.Tags) == 0 {
+		return profile
+	}
+	// Accept only classes of ways which are listed in configuration
+	speeds := make(map[string]float64, len(cfg.Tags))
+	for _, tag := range cfg.Tags {
+		speed, ok := profile.Speeds[tag]
+		if !ok {
+			speed = fallbackSpeed
+		}
+		speeds[tag] = speed
+	}
+	profile.Speeds = speeds
+	if cfg.EntityName != "" {
+		profile.EntityName = cfg.EntityName
+	}
+	return profile
+}
+
+// nodeStore Creates storage for coordinates of nodes
+func (cfg *OsmConfiguration) nodeStore() (NodeStore, error) {
+	if cfg.NodeStore == nil {
+		return NewMapNodeStore(), nil
+	}
+	return cfg.NodeStore()
+}
+
+// decoderProcs Returns number of goroutines for decoding of PBF blocks
+func (cfg *OsmConfiguration) decoderProcs() int {
+	if cfg.DecoderProcs <= 0 {
+		return defaultDecoderProcs
+	}
+	return cfg.DecoderProcs
+}
+
+// workers Returns number of goroutines for preparing and expanding edges
+func (cfg *OsmConfiguration) workers() int {
+	if cfg.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return cfg.Workers
+}
+
+// logger Returns receiver of progress of import
+func (cfg *OsmConfiguration) logger() Logger {
+	if cfg.Logger == nil {
+		return nopLogger{}
+	}
+	return cfg.Logger
+}
+
+// restrictionDiagnostics Returns collector of diagnostics of restrictions. Returns nil if diagnostics is disabled
+func (cfg *OsmConfiguration) restrictionDiagnostics() restrictionDiagnostics {
+	if !cfg.RestrictionDiagnostics {
+		return nil
+	}
+	return make(restrictionDiagnostics)
+}
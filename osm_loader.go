@@ -5,458 +5,391 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/paulmach/osm"
 	"github.com/pkg/errors"
-
-	"github.com/paulmach/osm/osmpbf"
 )
 
-// ImportFromOSMFile Imports graph from file of PBF-format (in OSM terms)
+// ImportFromOSMFile Imports edge expanded graph from OSM file
 /*
-	File should have PBF (Protocolbuffer Binary Format) extension according to https://github.com/paulmach/osm
+	File could be in PBF (Protocolbuffer Binary Format), XML or bzip2 compressed XML format (see the ref. at ImportGraphFromOSMFile).
+	Graph mode of configuration is ignored: edge expanded graph is always produced. Use ImportGraphFromOSMFile for node based graph
 */
 func ImportFromOSMFile(fileName string, cfg *OsmConfiguration) ([]ExpandedEdge, error) {
-	f, err := os.Open(fileName)
+	expandedCfg := *cfg
+	expandedCfg.Mode = GraphModeExpanded
+	graph, err := ImportGraphFromOSMFile(fileName, &expandedCfg)
 	if err != nil {
-		return nil, errors.Wrap(err, "File open")
+		return nil, err
 	}
-	defer f.Close()
+	return graph.ExpandedEdges, nil
+}
+
+// ImportGraphFromOSMFile Imports graph from OSM file
+/*
+	Type of graph is defined by Mode field of configuration:
+		GraphModeExpanded - both edges and edge expanded graph are returned;
+		GraphModeNode - only node based graph is returned (edge expanding and restrictions are skipped)
+	Unless Format field of configuration is set, format of file is defined by extension ('*.osm.pbf', '*.osm', '*.osm.bz2')
+	or by content of file when extension is unknown
+*/
+func ImportGraphFromOSMFile(fileName string, cfg *OsmConfiguration) (*Graph, error) {
+	return ImportGraphFromOSMFiles([]string{fileName}, cfg)
+}
 
-	scannerWays := osmpbf.New(context.Background(), f, 4)
-	defer scannerWays.Close()
+// ImportGraphFromOSMFiles Imports single graph from several OSM files (e.g. overlapping regional extracts of neighbouring countries)
+/*
+	Objects which are met in several files are deduplicated (see the ref. at ImportAll).
+	Unless Format field of configuration is set, format of every file is defined by extension or by content of file
+*/
+func ImportGraphFromOSMFiles(fileNames []string, cfg *OsmConfiguration) (*Graph, error) {
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("No OSM files are provided")
+	}
+	sources := make([]io.ReadSeeker, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "File open")
+		}
+		defer f.Close()
+		sources = append(sources, f)
+	}
+	if cfg.Format == FormatAuto {
+		// Extension is used only if it is the same for every file. Otherwise format is detected by content of every file
+		format := formatByExtension(fileNames[0])
+		for _, fileName := range fileNames[1:] {
+			if formatByExtension(fileName) != format {
+				format = FormatAuto
+			}
+		}
+		fileCfg := *cfg
+		fileCfg.Format = format
+		cfg = &fileCfg
+	}
+	return ImportAll(context.Background(), sources, cfg)
+}
+
+// Import Imports graph from OSM data which is read from given source
+/*
+	Source is read three times (ways, nodes and relations), so it should support seeking to the start. It is not closed by function.
+	Format of data is defined by Format field of configuration or it is detected by content when it is not set.
+	Import could be interrupted via context: then *CancelledError is returned (errors.Is(err, context.Canceled) works for it too).
+	See the ref. at ImportGraphFromOSMFile for graph types.
+	If State field of configuration is set then state of the build is recorded into it (stable identifiers are used then)
+*/
+func Import(ctx context.Context, r io.ReadSeeker, cfg *OsmConfiguration) (*Graph, error) {
+	return ImportAll(ctx, []io.ReadSeeker{r}, cfg)
+}
+
+// ImportAll Imports single graph from several sources of OSM data (e.g. overlapping regional extracts)
+/*
+	Objects which are met in several sources are deduplicated by ID: the highest version wins (the first met one in case of equal versions).
+	Format of every source is detected by content unless Format field of configuration is set (then it is used for every source).
+	See the ref. at Import for other details
+*/
+func ImportAll(ctx context.Context, sources []io.ReadSeeker, cfg *OsmConfiguration) (*Graph, error) {
+	if cfg.State != nil {
+		cfg = cfg.State.configure(cfg)
+		cfg.State.clearObjects()
+	}
+	formats := make([]InputFormat, len(sources))
+	for i, r := range sources {
+		formats[i] = cfg.Format
+		if formats[i] == FormatAuto {
+			var err error
+			formats[i], err = detectFormat(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Versions are tracked only when duplicates are possible
+	var wayVersions, nodeVersions, relationVersions objectVersions
+	if len(sources) > 1 {
+		wayVersions, nodeVersions, relationVersions = make(objectVersions), make(objectVersions), make(objectVersions)
+	}
 
+	profile := cfg.profile()
+	logger := cfg.logger()
 	ways := []Way{}
-	nodes := make(map[osm.NodeID]Node)
-	nodesSeen := make(map[osm.NodeID]struct{})
+	wayIndices := make(map[osm.WayID]int)
+	// References are deduplicated as they are met: peak memory doesn't depend on number of references
+	referencedNodes := newNodeSet()
+	// Nodes of every way (routable or not) are kept in state
+	var stateNodes *nodeSet
+	if cfg.State != nil {
+		stateNodes = newNodeSet()
+	}
 
-	fmt.Printf("Scanning ways...")
-	st := time.Now()
-	for scannerWays.Scan() {
-		obj := scannerWays.Object()
+	stage := startStage(logger, "ways")
+	err := scanSources(ctx, sources, formats, cfg.decoderProcs(), "ways", logger, func(obj osm.Object) error {
 		if obj.ObjectID().Type() != "way" {
-			continue
+			return nil
 		}
 		way := obj.(*osm.Way)
-		tagMap := way.TagMap()
-		tag, ok := tagMap[cfg.EntityName]
-		if !ok {
-			continue
+		if !wayVersions.newer(int64(way.ID), way.Version) {
+			return nil
 		}
-		if !cfg.CheckTag(tag) {
-			continue
+		if cfg.State != nil {
+			cfg.State.putWay(way)
+			for _, node := range way.Nodes {
+				stateNodes.add(node.ID)
+			}
 		}
-		oneway := false
-		if v, ok := tagMap["oneway"]; ok {
-			if v == "yes" || v == "1" {
-				oneway = true
+		preparedWay, ok := cfg.prepareWay(way, profile)
+		idx, seen := wayIndices[way.ID]
+		if !ok {
+			if seen {
+				// Newer version of way is not routable anymore
+				ways[idx].Nodes = nil
+				delete(wayIndices, way.ID)
 			}
+			return nil
 		}
-		nodes := way.Nodes
-		preparedWay := Way{
-			ID:     way.ID,
-			Nodes:  make(osm.WayNodes, len(nodes)),
-			Oneway: oneway,
-			TagMap: make(osm.Tags, len(way.Tags)),
+		if seen {
+			ways[idx] = preparedWay
+		} else {
+			wayIndices[way.ID] = len(ways)
+			ways = append(ways, preparedWay)
 		}
-		copy(preparedWay.Nodes, nodes)
-		copy(preparedWay.TagMap, way.Tags)
-		ways = append(ways, preparedWay)
-		for _, node := range nodes {
-			nodesSeen[node.ID] = struct{}{}
+		for _, node := range way.Nodes {
+			referencedNodes.add(node.ID)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if scannerWays.Err() != nil {
-		return nil, errors.Wrap(scannerWays.Err(), "Scanner error on Ways")
-	}
-	fmt.Printf("Done in %v\n\tWays: %d\n", time.Since(st), len(ways))
+	ways = compactWays(ways)
+	wayIndices = nil
+	wayVersions = nil
+	stats := newImportStats()
+	stats.Ways = len(ways)
+	stage.finish(Counter{"ways", len(ways)})
 
-	// Seek file to start
-	_, err = f.Seek(0, io.SeekStart)
+	refs := newNodeRefs(referencedNodes.sorted())
+	referencedNodes = nil
+	nodes, err := cfg.nodeStore()
 	if err != nil {
-		return nil, errors.Wrap(err, "Can't repeat seeking after ways scanning")
+		return nil, err
 	}
-	scannerNodes := osmpbf.New(context.Background(), f, 4)
-	defer scannerNodes.Close()
+	defer nodes.Close()
+	nodeCosts := make(map[osm.NodeID]nodeCost)
+	nodesFound := 0
 
-	fmt.Printf("Scanning nodes...")
-	st = time.Now()
-	for scannerNodes.Scan() {
-		obj := scannerNodes.Object()
+	stage = startStage(logger, "nodes")
+	err = scanSources(ctx, sources, formats, cfg.decoderProcs(), "nodes", logger, func(obj osm.Object) error {
 		if obj.ObjectID().Type() != "node" {
-			continue
+			return nil
 		}
 		node := obj.(*osm.Node)
-		if _, ok := nodesSeen[node.ID]; ok {
-			delete(nodesSeen, node.ID)
-			nodes[node.ID] = Node{
-				ID:       node.ID,
-				useCount: 0,
-				node:     *node,
-			}
+		idx := refs.index(node.ID)
+		kept := stateNodes != nil && stateNodes.contains(node.ID)
+		if idx < 0 && !kept {
+			return nil
+		}
+		if !nodeVersions.newer(int64(node.ID), node.Version) {
+			return nil
 		}
+		if kept {
+			cfg.State.putNode(node)
+		}
+		if idx < 0 {
+			return nil
+		}
+		if !refs.found[idx] {
+			refs.found[idx] = true
+			nodesFound++
+		}
+		if err := nodes.Put(node.ID, GeoPoint{Lon: node.Lon, Lat: node.Lat}); err != nil {
+			return err
+		}
+		if cost := cfg.nodeCost(node.Tags, profile); cost.significant() {
+			nodeCosts[node.ID] = cost
+		} else {
+			delete(nodeCosts, node.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if scannerNodes.Err() != nil {
-		return nil, errors.Wrap(scannerNodes.Err(), "Scanner error on Nodes")
+	nodeVersions = nil
+	stateNodes = nil
+	if err := nodes.Seal(); err != nil {
+		return nil, err
 	}
-	fmt.Printf("Done in %v\n\tNodes: %d\n", time.Since(st), len(nodes))
+	stats.Nodes = nodesFound
+	stage.finish(Counter{"nodes", nodesFound})
 
-	// Seek file to start
-	_, err = f.Seek(0, io.SeekStart)
+	stage = startStage(logger, "relations")
+	restrictions := []restriction{}
+	restrictionIndices := make(map[osm.RelationID]int)
+	diagnostics := cfg.restrictionDiagnostics()
+	// Statistics of restrictions are collected after older versions of relations are superseded
+	counts := make(restrictionCounts)
+	err = scanSources(ctx, sources, formats, cfg.decoderProcs(), "relations", logger, func(obj osm.Object) error {
+		if obj.ObjectID().Type() != "relation" {
+			return nil
+		}
+		relation := obj.(*osm.Relation)
+		if !relationVersions.newer(int64(relation.ID), relation.Version) {
+			return nil
+		}
+		// Older version of restriction (if any) is superseded
+		if idx, seen := restrictionIndices[relation.ID]; seen {
+			restrictions[idx].ID = 0
+			delete(restrictionIndices, relation.ID)
+		}
+		delete(diagnostics, relation.ID)
+		delete(counts, relation.ID)
+		if cfg.State != nil {
+			cfg.State.deleteRelation(relation.ID)
+		}
+		tags := cfg.resolveTags(relation.Tags)
+		tag, ok := restrictionTypeForMode(tags, profile.Mode())
+		if !ok {
+			if tags.Find("type") == "restriction" {
+				diagnostics.add(relation, anyRestrictionType(tags), RestrictionOtherMode)
+			}
+			return nil
+		}
+		if cfg.State != nil {
+			cfg.State.putRelation(relation)
+		}
+		r, unsupportedRoles, outcome := parseRestriction(relation, tag)
+		counts[relation.ID] = countedRestriction{tag: tag, restriction: r, unsupportedRoles: unsupportedRoles, outcome: outcome}
+		diagnostics.add(relation, tag, outcome)
+		if outcome != RestrictionPending {
+			return nil
+		}
+		restrictionIndices[relation.ID] = len(restrictions)
+		restrictions = append(restrictions, r)
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "Can't repeat seeking after nodes scanning")
+		return nil, err
 	}
-	scannerManeuvers := osmpbf.New(context.Background(), f, 4)
-	defer scannerManeuvers.Close()
-	fmt.Printf("Scanning maneuvers (restrictions)...")
-	st = time.Now()
-	skippedRestrictions := 0
-	unsupportedRestrictionRoles := 0
-	possibleRestrictionCombos := make(map[string]map[string]bool)
-	restrictions := make(map[string]map[restrictionComponent]map[restrictionComponent]restrictionComponent)
-	for scannerManeuvers.Scan() {
-		obj := scannerManeuvers.Object()
-		if obj.ObjectID().Type() == "relation" {
-			relation := obj.(*osm.Relation)
-			tagMap := relation.TagMap()
-			tag, ok := tagMap["restriction"]
-			if !ok {
-				continue
-			}
-			members := relation.Members
-			if len(members) != 3 {
-				skippedRestrictions++
-				// fmt.Printf("Restriction does not contain 3 members, relation ID: %d. Skip it\n", relation.ID)
-				continue
-			}
-			firstMember := restrictionComponent{-1, ""}
-			secondMember := restrictionComponent{-1, ""}
-			thirdMember := restrictionComponent{-1, ""}
+	restrictions = compactRestrictions(restrictions)
+	stats.addRestrictions(counts)
+	counts = nil
+	stats.Restrictions = len(restrictions)
+	// Skipped restrictions have unsupported set of members. Only 'from', 'to' and 'via' roles are known
+	stage.finish(
+		Counter{"restrictions", stats.Restrictions},
+		Counter{"skipped_restrictions", stats.SkippedRestrictions},
+		Counter{"unknown_restriction_roles", stats.UnsupportedRestrictionRoles},
+	)
 
-			switch members[0].Role {
-			case "from":
-				firstMember = restrictionComponent{members[0].Ref, string(members[0].Type)}
-				break
-			case "via":
-				thirdMember = restrictionComponent{members[0].Ref, string(members[0].Type)}
-				break
-			case "to":
-				secondMember = restrictionComponent{members[0].Ref, string(members[0].Type)}
-				break
-			default:
-				unsupportedRestrictionRoles++
-				// fmt.Printf("Something went wrong for first member of relation with ID: %d\n", relation.ID)
-				break
-			}
-
-			switch members[1].Role {
-			case "from":
-				firstMember = restrictionComponent{members[1].Ref, string(members[1].Type)}
-				break
-			case "via":
-				thirdMember = restrictionComponent{members[1].Ref, string(members[1].Type)}
-				break
-			case "to":
-				secondMember = restrictionComponent{members[1].Ref, string(members[1].Type)}
-				break
-			default:
-				unsupportedRestrictionRoles++
-				// fmt.Printf("Something went wrong for second member of relation with ID: %d\n", relation.ID)
-				break
-			}
-
-			switch members[2].Role {
-			case "from":
-				firstMember = restrictionComponent{members[2].Ref, string(members[2].Type)}
-				break
-			case "via":
-				thirdMember = restrictionComponent{members[2].Ref, string(members[2].Type)}
-				break
-			case "to":
-				secondMember = restrictionComponent{members[2].Ref, string(members[2].Type)}
-				break
-			default:
-				unsupportedRestrictionRoles++
-				// fmt.Printf("Something went wrong for third member of relation with ID: %d\n", relation.ID)
-				break
-			}
-			if _, ok := possibleRestrictionCombos[tag]; !ok {
-				possibleRestrictionCombos[tag] = make(map[string]bool)
-			}
-			possibleRestrictionCombos[tag][fmt.Sprintf("%s;%s;%s", firstMember.Type, secondMember.Type, thirdMember.Type)] = true
+	graph, err := buildGraph(ctx, cfg, profile, ways, refs, nodes, nodeCosts, restrictions, stats, diagnostics)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.State != nil {
+		cfg.State.recordEdges(graph.Edges)
+	}
+	return graph, nil
+}
 
-			if _, ok := restrictions[tag]; !ok {
-				restrictions[tag] = make(map[restrictionComponent]map[restrictionComponent]restrictionComponent)
-			}
-			if _, ok := restrictions[tag][firstMember]; !ok {
-				restrictions[tag][firstMember] = make(map[restrictionComponent]restrictionComponent)
-			}
-			if _, ok := restrictions[tag][firstMember][secondMember]; !ok {
-				restrictions[tag][firstMember][secondMember] = thirdMember
+// buildGraph Prepares graph from ways, nodes and restrictions which are extracted from OSM data
+/*
+	Coordinates of every node of ways should be put to the store already (and store should be sealed).
+	Ways are clipped by ClipArea of configuration if it is set (nodes which are created on boundary are added to the set of nodes).
+	Statistics should contain counters of scanning already: counters of graph are added to it and it is attached to the result.
+	The same is true for diagnostics of restrictions (if it is enabled): outcomes of applying of restrictions are added to it
+*/
+func buildGraph(ctx context.Context, cfg *OsmConfiguration, profile Profile, ways []Way, refs *nodeRefs, nodes NodeStore, nodeCosts map[osm.NodeID]nodeCost, restrictions []restriction, stats *ImportStats, diagnostics restrictionDiagnostics) (*Graph, error) {
+	logger := cfg.logger()
+	if cfg.ClipArea != nil {
+		stage := startStage(logger, "clipping")
+		waysBefore := len(ways)
+		var boundaryNodes map[osm.NodeID]GeoPoint
+		ways, boundaryNodes = clipWays(ways, nodes, cfg.ClipArea, cfg.ClipPolicy)
+		if len(boundaryNodes) != 0 {
+			ids := make([]osm.NodeID, 0, len(boundaryNodes))
+			for id := range boundaryNodes {
+				ids = append(ids, id)
 			}
+			refs = refs.extend(ids)
+			nodes = overlayNodeStore{NodeStore: nodes, extra: boundaryNodes}
 		}
+		stage.finish(Counter{"ways", len(ways)}, Counter{"ways_before_clipping", waysBefore}, Counter{"boundary_nodes", len(boundaryNodes)})
 	}
-	fmt.Printf("Done in %v\n", time.Since(st))
-	fmt.Printf("\tSkipped restrictions (which have not exactly 3 members): %d\n", skippedRestrictions)
-	fmt.Printf("\tNumber of unknow restriction roles (only 'from', 'to' and 'via' supported): %d\n", unsupportedRestrictionRoles)
+	stats.WaysAfterClipping = len(ways)
 
-	fmt.Printf("Counting node use cases...")
-	st = time.Now()
+	stage := startStage(logger, "counting")
 	for _, way := range ways {
 		for i, wayNode := range way.Nodes {
-			if node, ok := nodes[wayNode.ID]; ok {
-				if i == 0 || i == len(way.Nodes)-1 {
-					node.useCount += 2
-					nodes[wayNode.ID] = node
-				} else {
-					node.useCount += 1
-					nodes[wayNode.ID] = node
-				}
-			} else {
+			idx := refs.index(wayNode.ID)
+			if idx < 0 || !refs.found[idx] {
 				return nil, fmt.Errorf("Missing node with id: %d\n", wayNode.ID)
 			}
-		}
-	}
-	fmt.Printf("Done in %v\n", time.Since(st))
-
-	fmt.Printf("Preparing edges...")
-	st = time.Now()
-	edges := []Edge{}
-	onewayEdges := 0
-	notOnewayEdges := 0
-	totalEdgesNum := int64(0)
-	waysSeen := make(map[osm.WayID]struct{})
-	for _, way := range ways {
-		var source osm.NodeID
-		waysSeen[way.ID] = struct{}{}
-		geometry := []GeoPoint{}
-		for i, wayNode := range way.Nodes {
-			node := nodes[wayNode.ID]
-			if i == 0 {
-				source = wayNode.ID
-				geometry = append(geometry, GeoPoint{Lon: node.node.Lon, Lat: node.node.Lat})
+			// Nodes with penalties and barriers should become vertices too
+			if i == 0 || i == len(way.Nodes)-1 || nodeCosts[wayNode.ID].significant() {
+				refs.useCounts[idx] += 2
 			} else {
-				geometry = append(geometry, GeoPoint{Lon: node.node.Lon, Lat: node.node.Lat})
-				if node.useCount > 1 {
-					totalEdgesNum++
-					onewayEdges++
-					cost := getSphericalLength(geometry) * 1000.0 // meters
-					edges = append(edges, Edge{
-						ID:           EdgeID(totalEdgesNum),
-						WayID:        way.ID,
-						SourceNodeID: source,
-						TargetNodeID: wayNode.ID,
-						CostMeters:   cost,
-						Geom:         copyLine(geometry),
-						WasOneway:    way.Oneway,
-						Tags:         way.TagMap,
-					})
-					if !way.Oneway {
-						totalEdgesNum++
-						notOnewayEdges++
-						edges = append(edges, Edge{
-							ID:           EdgeID(totalEdgesNum),
-							WayID:        way.ID,
-							SourceNodeID: wayNode.ID,
-							TargetNodeID: source,
-							CostMeters:   cost,
-							Geom:         reverseLine(geometry),
-							WasOneway:    false,
-							Tags:         way.TagMap,
-						})
-					}
-					source = wayNode.ID
-					geometry = []GeoPoint{GeoPoint{Lon: node.node.Lon, Lat: node.node.Lat}}
-				}
+				refs.useCounts[idx]++
 			}
 		}
 	}
-	fmt.Printf("Done in %v\n\tEdges: (oneway = %d), (not oneway = %d) (total = %d)\n", time.Since(st), onewayEdges, notOnewayEdges, totalEdgesNum)
-
-	fmt.Printf("Preparing nodes...")
-	st = time.Now()
-	nodesFiltered := []Node{}
-	for _, node := range nodes {
-		if node.useCount > 1 {
-			nodesFiltered = append(nodesFiltered, node)
-		}
-	}
-	fmt.Printf("Done in %v\n\tNodes: %d\n", time.Since(st), len(nodesFiltered))
+	stage.finish()
 
-	fmt.Printf("Applying edge expanding technique...")
-	st = time.Now()
-
-	// create edge index by SourceNodeID
-	edgesBySourceNodeID := make(map[osm.NodeID][]EdgeID)
-	for _, edge := range edges {
-		edgesBySourceNodeID[edge.SourceNodeID] = append(edgesBySourceNodeID[edge.SourceNodeID], edge.ID)
+	if err := checkCancelled(ctx, "edges"); err != nil {
+		return nil, err
 	}
-
-	cycles := 0
-	expandedEdges := []ExpandedEdge{}
-	expandedEdgesTotal := int64(0)
+	stage = startStage(logger, "edges")
+	edges := prepareEdges(ways, refs, nodes, profile, cfg.workers())
+	ids := cfg.idAssigner()
+	ids.assignEdges(edges)
+	onewayEdges, notOnewayEdges := 0, 0
 	for _, edge := range edges {
-		edgeAsFromVertex := edge
-		costMetersFromVertex := edgeAsFromVertex.CostMeters
-		outcomingEdges := edgesBySourceNodeID[edgeAsFromVertex.TargetNodeID]
-		for _, outcomingEdge := range outcomingEdges {
-			if outcomingEdge == edgeAsFromVertex.ID {
-				continue
-			}
-			edgeAsToVertex := edges[outcomingEdge-1] // We assuming that EdgeID == (SliceIndex + 1) which is equivalent to SliceIndex == (EdgeID - 1)
-			// cycles, u-turn?
-			// @todo: some of those are deadend (or 'boundary') edges
-			if edgeAsFromVertex.Geom[0] == edgeAsToVertex.Geom[len(edgeAsToVertex.Geom)-1] && edgeAsFromVertex.Geom[len(edgeAsFromVertex.Geom)-1] == edgeAsToVertex.Geom[0] {
-				// fmt.Println(PrepareGeoJSONLinestring(edgeAsFromVertex.Geom))
-				cycles++
-				continue
-			}
-			costMetersToVertex := edgeAsToVertex.CostMeters
-			expandedEdgesTotal++
-			beforeFromIdx, fromMiddlePoint := findMiddlePoint(edgeAsFromVertex.Geom)
-			fromGeomHalf := append([]GeoPoint{fromMiddlePoint}, edgeAsFromVertex.Geom[beforeFromIdx+1:len(edgeAsFromVertex.Geom)]...)
-			beforeToIdx, toMiddlePoint := findMiddlePoint(edgeAsToVertex.Geom)
-			toGeomHalf := append(make([]GeoPoint, 0, len(edgeAsToVertex.Geom[:beforeToIdx+1])+1), edgeAsToVertex.Geom[:beforeToIdx+1]...)
-			toGeomHalf = append(toGeomHalf, toMiddlePoint)
-			completedNewGeom := append(fromGeomHalf, toGeomHalf...)
-			expandedEdges = append(expandedEdges, ExpandedEdge{
-				ID:             expandedEdgesTotal,
-				Source:         edgeAsFromVertex.ID,
-				Target:         edgeAsToVertex.ID,
-				SourceOSMWayID: edgeAsFromVertex.WayID,
-				TargetOSMWayID: edgeAsToVertex.WayID,
-				SourceComponent: ExpandedEdgeComponent{
-					SourceNodeID: edgeAsFromVertex.SourceNodeID,
-					TargetNodeID: edgeAsFromVertex.TargetNodeID,
-					Tags:         edgeAsFromVertex.Tags,
-					CostMeters:   costMetersFromVertex / 2.0,
-				},
-				TargetComponent: ExpandedEdgeComponent{
-					SourceNodeID: edgeAsToVertex.SourceNodeID,
-					TargetNodeID: edgeAsToVertex.TargetNodeID,
-					Tags:         edgeAsToVertex.Tags,
-					CostMeters:   costMetersToVertex / 2.0,
-				},
-				CostMeters: (costMetersFromVertex + costMetersToVertex) / 2.0,
-				WasOneway:  edgeAsFromVertex.WasOneway,
-				Geom:       completedNewGeom,
-			})
+		if edge.WasOneway {
+			onewayEdges++
+		} else {
+			notOnewayEdges++
 		}
 	}
-	fmt.Printf("Done in %v\n", time.Since(st))
-	fmt.Printf("\tIgnored cycles: %d\n", cycles)
-	fmt.Printf("\tNumber of expanded edges: %d\n", expandedEdgesTotal)
-
-	// @todo: work with maneuvers (restrictions)
-	fmt.Printf("Working with maneuvers (restrictions)...")
-	st = time.Now()
+	stats.OnewayEdges, stats.NotOnewayEdges, stats.Edges = onewayEdges, notOnewayEdges, len(edges)
+	stage.finish(Counter{"oneway_edges", onewayEdges}, Counter{"not_oneway_edges", notOnewayEdges}, Counter{"edges", len(edges)})
 
-	// create index by SourceOSMWayID -> edge index
-	edgeIndexBySourceWayID := make(map[osm.WayID][]int)
-	for i, edge := range expandedEdges {
-		edgeIndexBySourceWayID[edge.SourceOSMWayID] = append(edgeIndexBySourceWayID[edge.SourceOSMWayID], i)
-	}
-
-	// slice of edges which should be deleted
-	toDelete := make([]bool, len(expandedEdges))
-
-	// Handling restrictions of "no" type
-	for i, k := range restrictions {
-		switch i {
-		case "no_left_turn", "no_right_turn", "no_straight_on":
-			// handle only way(from)-way(to)-node(via)
-			for j, v := range k {
-				if j.Type != "way" { // way(from)
-					continue
-				}
-				fromOSMWayID := osm.WayID(j.ID)
-				if _, ok := waysSeen[fromOSMWayID]; !ok {
-					continue
-				}
-				for n := range v {
-					if n.Type != "way" { // way(to)
-						continue
-					}
-					if v[n].Type != "node" { // node(via)
-						continue
-					}
-					toOSMWayID := osm.WayID(n.ID)
-					if _, ok := waysSeen[toOSMWayID]; !ok {
-						continue
-					}
-					// Delete restricted expanded edge
-					edgeIndices := edgeIndexBySourceWayID[fromOSMWayID]
-
-					for _, edgeIndex := range edgeIndices {
-						if expandedEdges[edgeIndex].TargetOSMWayID == toOSMWayID {
-							toDelete[edgeIndex] = true
-						}
-					}
-				}
-			}
-			break
-		default:
-			// @todo: need to think about U-turns: "no_u_turn"
-			break
+	stage = startStage(logger, "vertices")
+	verticesNum := 0
+	for _, useCount := range refs.useCounts {
+		if useCount > 1 {
+			verticesNum++
 		}
 	}
-	// Handling restrictions of "only" type
-	for i, k := range restrictions {
-		switch i {
-		case "only_left_turn", "only_right_turn", "only_straight_on":
-			// handle only way(from)-way(to)-node(via)
-			for j, v := range k {
-				if j.Type != "way" { // way(from)
-					continue
-				}
-				fromOSMWayID := osm.WayID(j.ID)
-				if _, ok := waysSeen[fromOSMWayID]; !ok {
-					continue
-				}
-				for n := range v {
-					if n.Type != "way" { // way(to)
-						continue
-					}
-					if v[n].Type != "node" { // node(via)
-						continue
-					}
-					toOSMWayID := osm.WayID(n.ID)
-					if _, ok := waysSeen[toOSMWayID]; !ok {
-						continue
-					}
-					rvertexVia := v[n].ID
-
-					// Delete relevant expanded edges
-					edgeIndices := edgeIndexBySourceWayID[fromOSMWayID]
+	stats.Vertices = verticesNum
+	stage.finish(Counter{"vertices", verticesNum})
 
-					for _, edgeIndex := range edgeIndices {
-						expEdge := expandedEdges[edgeIndex]
-						if expEdge.TargetOSMWayID != toOSMWayID && expEdge.SourceComponent.TargetNodeID == osm.NodeID(rvertexVia) {
-							toDelete[edgeIndex] = true
-						}
-					}
-				}
-			}
-			break
-		default:
-			// @todo: need to think about U-turns: "no_u_turn"
-			break
-		}
+	if cfg.Mode == GraphModeNode {
+		stage = startStage(logger, "node_based")
+		edges = nodeBasedEdges(edges, nodeCosts)
+		stats.Edges = len(edges)
+		stage.finish(Counter{"edges", len(edges)})
+		diagnostics.resolvePending(RestrictionNodeBasedGraph)
+		return &Graph{Edges: edges, Stats: *stats, RestrictionReports: diagnostics.reports()}, nil
 	}
 
-	// Apply deletions
-	{
-		temp := expandedEdges[:0]
-		for i, expEdge := range expandedEdges {
-			if !toDelete[i] {
-				temp = append(temp, expEdge)
-			}
-		}
-		expandedEdges = temp
+	if err := checkCancelled(ctx, "expanding"); err != nil {
+		return nil, err
 	}
+	stage = startStage(logger, "expanding")
+	expandedEdges, cycles := expandEdges(edges, nodeCosts, cfg)
+	ids.assignExpandedEdges(expandedEdges)
+	stats.IgnoredCycles = cycles
+	stage.finish(Counter{"ignored_cycles", cycles}, Counter{"expanded_edges", len(expandedEdges)})
 
-	fmt.Printf("Done in %v\n", time.Since(st))
-	fmt.Printf("\tUpdated of expanded edges: %d\n", len(expandedEdges))
-	return expandedEdges, nil
+	if err := checkCancelled(ctx, "restrictions"); err != nil {
+		return nil, err
+	}
+	stage = startStage(logger, "restrictions")
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	appliedRestrictions := graph.applyRestrictions(restrictions)
+	expandedEdges = graph.result()
+	diagnostics.addResults(graph.results)
+	stats.AppliedRestrictions, stats.ExpandedEdges = appliedRestrictions, len(expandedEdges)
+	stage.finish(Counter{"applied_restrictions", appliedRestrictions}, Counter{"expanded_edges", len(expandedEdges)})
+	return &Graph{Edges: edges, ExpandedEdges: expandedEdges, OriginalVertices: graph.originals, Stats: *stats, RestrictionReports: diagnostics.reports()}, nil
 }
@@ -0,0 +1,230 @@
+package osm2ch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Import(ctx, bytes.NewReader([]byte{}), &OsmConfiguration{Format: FormatPBF})
+	cancelledErr := &CancelledError{}
+	if !errors.As(err, &cancelledErr) {
+		t.Errorf("CancelledError is expected, but got %v", err)
+		return
+	}
+	if cancelledErr.Stage != "ways" {
+		t.Errorf("Import should be cancelled on stage 'ways', but got '%s'", cancelledErr.Stage)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Error should wrap context.Canceled")
+	}
+}
+
+func TestImportXML(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/crossroad.osm")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Format should be detected by extension of file or by content
+	for _, importFn := range []func() (*Graph, error){
+		func() (*Graph, error) { return ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{}) },
+		func() (*Graph, error) {
+			return ImportGraphFromOSMFile("testdata/crossroad.osm.bz2", &OsmConfiguration{})
+		},
+		func() (*Graph, error) {
+			return Import(context.Background(), bytes.NewReader(data), &OsmConfiguration{})
+		},
+	} {
+		graph, err := importFn()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(graph.Edges) != 8 {
+			t.Errorf("Number of edges should be %d, but got %d", 8, len(graph.Edges))
+		}
+		// Every of 4 incoming edges of crossroad has 3 possible turns (U-turns are ignored) minus 1 restricted turn
+		if len(graph.ExpandedEdges) != 11 {
+			t.Errorf("Number of expanded edges should be %d, but got %d", 11, len(graph.ExpandedEdges))
+		}
+		for _, expEdge := range graph.ExpandedEdges {
+			if expEdge.SourceOSMWayID == 101 && expEdge.TargetOSMWayID == 201 {
+				t.Errorf("Turn from way 101 to way 201 should be prohibited")
+			}
+		}
+	}
+}
+
+func TestImportWorkersDeterminism(t *testing.T) {
+	sequential, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{Workers: 1})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, workers := range []int{2, 3, 16} {
+		parallel, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{Workers: workers})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(sequential, parallel) {
+			t.Errorf("Graph prepared by %d workers should be the same as graph prepared by single worker", workers)
+		}
+	}
+}
+
+// recordingLogger Keeps events of import
+type recordingLogger struct {
+	stages   []string
+	counters map[string]map[string]int
+	percent  float64
+}
+
+func (logger *recordingLogger) StageStarted(stage string) {
+	logger.stages = append(logger.stages, stage)
+}
+
+func (logger *recordingLogger) StageFinished(stage string, elapsed time.Duration, counters []Counter) {
+	logger.counters[stage] = make(map[string]int)
+	for _, counter := range counters {
+		logger.counters[stage][counter.Name] = counter.Value
+	}
+}
+
+func (logger *recordingLogger) Progress(stage string, percent float64) {
+	logger.percent = percent
+}
+
+func TestImportLogger(t *testing.T) {
+	logger := &recordingLogger{counters: make(map[string]map[string]int)}
+	_, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{Logger: logger})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expectedStages := []string{"ways", "nodes", "relations", "counting", "edges", "vertices", "expanding", "restrictions"}
+	if !reflect.DeepEqual(logger.stages, expectedStages) {
+		t.Errorf("Stages should be %v, but got %v", expectedStages, logger.stages)
+	}
+	if logger.counters["edges"]["edges"] != 8 {
+		t.Errorf("Number of edges should be %d, but got %d", 8, logger.counters["edges"]["edges"])
+	}
+	if logger.counters["restrictions"]["expanded_edges"] != 11 {
+		t.Errorf("Number of expanded edges should be %d, but got %d", 11, logger.counters["restrictions"]["expanded_edges"])
+	}
+	if logger.percent != 100 {
+		t.Errorf("Progress should reach 100%%, but got %v", logger.percent)
+	}
+}
+
+func TestImportStats(t *testing.T) {
+	graph, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := ImportStats{
+		Ways:                4,
+		WaysAfterClipping:   4,
+		Nodes:               5,
+		Vertices:            5,
+		NotOnewayEdges:      8,
+		Edges:               8,
+		IgnoredCycles:       8,
+		ExpandedEdges:       11,
+		Restrictions:        1,
+		AppliedRestrictions: 1,
+		RestrictionCombos:   map[string][]string{"no_left_turn": {"way;way;node"}},
+	}
+	if !reflect.DeepEqual(graph.Stats, expected) {
+		t.Errorf("Statistics should be %+v, but got %+v", expected, graph.Stats)
+	}
+}
+
+func TestImportStatsOverlappingSources(t *testing.T) {
+	// Both versions of relation 301 have unsupported set of members: only the newer one should be counted
+	older := []byte(`<osm version="0.6">
+  <relation id="301" version="1">
+    <member type="way" ref="101" role="from"/>
+    <member type="node" ref="1" role="via"/>
+    <member type="way" ref="201" role="too"/>
+    <tag k="type" v="restriction"/>
+    <tag k="restriction" v="no_left_turn"/>
+  </relation>
+</osm>`)
+	newer := []byte(`<osm version="0.6">
+  <relation id="301" version="2">
+    <member type="way" ref="101" role="from"/>
+    <member type="way" ref="201" role="to"/>
+    <tag k="type" v="restriction"/>
+    <tag k="restriction" v="no_left_turn"/>
+  </relation>
+</osm>`)
+	data, err := ioutil.ReadFile("testdata/crossroad.osm")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	sources := []io.ReadSeeker{bytes.NewReader(data), bytes.NewReader(older), bytes.NewReader(newer), bytes.NewReader(data)}
+	graph, err := ImportAll(context.Background(), sources, &OsmConfiguration{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	stats := graph.Stats
+	if stats.Restrictions != 1 || stats.SkippedRestrictions != 1 || stats.UnsupportedRestrictionRoles != 0 {
+		t.Errorf("1 restriction, 1 skipped restriction and 0 unknown roles are expected, but got %d, %d and %d", stats.Restrictions, stats.SkippedRestrictions, stats.UnsupportedRestrictionRoles)
+	}
+	expectedCombos := map[string][]string{"no_left_turn": {"way;way;", "way;way;node"}}
+	if !reflect.DeepEqual(stats.RestrictionCombos, expectedCombos) {
+		t.Errorf("Combinations of members should be %v, but got %v", expectedCombos, stats.RestrictionCombos)
+	}
+}
+
+func TestImportRestrictionReports(t *testing.T) {
+	graph, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{RestrictionDiagnostics: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(graph.RestrictionReports) != 1 {
+		t.Errorf("Number of restriction reports should be %d, but got %d", 1, len(graph.RestrictionReports))
+		return
+	}
+	report := graph.RestrictionReports[0]
+	if report.ID != 300 || report.Type != "no_left_turn" || report.Outcome != RestrictionApplied {
+		t.Errorf("Restriction 300 of 'no_left_turn' type should be applied, but got %d of '%s' type with outcome '%s'", report.ID, report.Type, report.Outcome)
+	}
+	if len(report.Members) != 3 {
+		t.Errorf("Number of members should be %d, but got %d", 3, len(report.Members))
+	}
+	// The only turn from way 101 to way 201 is removed
+	if len(report.RemovedExpandedEdges) != 1 {
+		t.Errorf("Number of removed expanded edges should be %d, but got %d", 1, len(report.RemovedExpandedEdges))
+	}
+	for _, expEdge := range graph.ExpandedEdges {
+		for _, id := range report.RemovedExpandedEdges {
+			if expEdge.ID == id {
+				t.Errorf("Removed expanded edge %d should not be part of graph", id)
+			}
+		}
+	}
+
+	graph, err = ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{RestrictionDiagnostics: true, Mode: GraphModeNode})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(graph.RestrictionReports) != 1 || graph.RestrictionReports[0].Outcome != RestrictionNodeBasedGraph {
+		t.Errorf("Restriction should not be applied to node based graph")
+	}
+}
@@ -0,0 +1,37 @@
+package osm2ch
+
+import (
+	"sync"
+)
+
+// parallelChunks Splits range [0; n) into contiguous chunks (one per worker) and processes them concurrently.
+// Chunk number is passed to the function, so results could be gathered in order of chunks, which keeps output deterministic
+func parallelChunks(n, workers int, fn func(chunk, from, to int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers == 1 || n < workers {
+		fn(0, 0, n)
+		for chunk := 1; chunk < workers; chunk++ {
+			fn(chunk, n, n)
+		}
+		return
+	}
+	chunkSize := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for chunk := 0; chunk < workers; chunk++ {
+		from, to := chunk*chunkSize, (chunk+1)*chunkSize
+		if from > n {
+			from = n
+		}
+		if to > n {
+			to = n
+		}
+		wg.Add(1)
+		go func(chunk, from, to int) {
+			defer wg.Done()
+			fn(chunk, from, to)
+		}(chunk, from, to)
+	}
+	wg.Wait()
+}
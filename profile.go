@@ -0,0 +1,289 @@
+package osm2ch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// TransportMode Type of transport which graph is prepared for
+type TransportMode uint16
+
+const (
+	TransportModeCar = TransportMode(iota)
+	TransportModeBicycle
+	TransportModeFoot
+	TransportModeHGV
+)
+
+// String returns pretty printed value for TransportMode
+func (mode TransportMode) String() string {
+	switch mode {
+	case TransportModeCar:
+		return "car"
+	case TransportModeBicycle:
+		return "bicycle"
+	case TransportModeFoot:
+		return "foot"
+	case TransportModeHGV:
+		return "hgv"
+	default:
+		return fmt.Sprintf("unknown(%d)", mode)
+	}
+}
+
+// Profile Decides which ways are routable, in which directions and how they should be weighted
+/*
+	Methods of profile could be called concurrently from several workers during import, so implementations should be safe for concurrent use
+*/
+type Profile interface {
+	// Name Returns name of the profile
+	Name() string
+	// Mode Returns type of transport which profile is designed for
+	Mode() TransportMode
+	// Accept Returns true if way with given tags should be included into graph
+	Accept(tags osm.Tags) bool
+	// Direction Returns allowed directions of travelling along the way with given tags
+	Direction(tags osm.Tags) Direction
+	// Speed Returns travel speed (km/h) along the way with given tags. Forward is false for direction opposite to direction of way's nodes
+	Speed(tags osm.Tags, forward bool) float64
+	// Penalty Returns multiplier for travel time along the way with given tags. Value 1.0 means no penalty
+	Penalty(tags osm.Tags) float64
+	// NodePenalty Returns time penalty (seconds) for passing through the node with given tags (traffic signals, barriers and etc.).
+	// Returns false if node can't be passed at all
+	NodePenalty(tags osm.Tags) (float64, bool)
+}
+
+// VehicleProfile Table driven implementation of Profile. Built-in car, bicycle and foot profiles are based on it
+type VehicleProfile struct {
+	ProfileName   string
+	TransportMode TransportMode
+	// Key of OSM tag which defines class of the way. Usually it is 'highway'
+	EntityName string
+	// Accepted classes of ways and their default speeds (km/h)
+	Speeds map[string]float64
+	// Multipliers for travel time for classes of ways. Missing classes have no penalty
+	Penalties map[string]float64
+	// Upper bound for speed (km/h). Zero value means no bound
+	MaxSpeed float64
+	// Should 'maxspeed' tags be used for speed evaluation?
+	UseMaxSpeedTags bool
+	// Should 'oneway' tags be ignored?
+	IgnoreOneway bool
+	// Time penalties (seconds) for passing through nodes. Keys are in 'key=value' format, e.g. 'highway=traffic_signals' or 'barrier=gate'
+	NodePenalties map[string]float64
+	// Values of 'barrier' tag which can't be passed (unless access tags of the node allow it)
+	BlockingBarriers map[string]bool
+}
+
+// Name See the ref. at Profile interface
+func (profile *VehicleProfile) Name() string {
+	return profile.ProfileName
+}
+
+// Mode See the ref. at Profile interface
+func (profile *VehicleProfile) Mode() TransportMode {
+	return profile.TransportMode
+}
+
+// Accept See the ref. at Profile interface
+func (profile *VehicleProfile) Accept(tags osm.Tags) bool {
+	_, ok := profile.Speeds[tags.Find(profile.EntityName)]
+	return ok
+}
+
+// Direction See the ref. at Profile interface
+func (profile *VehicleProfile) Direction(tags osm.Tags) Direction {
+	if profile.IgnoreOneway {
+		return DirectionBoth
+	}
+	return wayDirectionForMode(tags, profile.EntityName, profile.TransportMode)
+}
+
+// Speed See the ref. at Profile interface
+func (profile *VehicleProfile) Speed(tags osm.Tags, forward bool) float64 {
+	speed := fallbackSpeed
+	if profile.UseMaxSpeedTags {
+		speed = wayMaxSpeed(tags, profile.EntityName, forward, profile.Speeds)
+	} else if v, ok := profile.Speeds[tags.Find(profile.EntityName)]; ok {
+		speed = v
+	}
+	if profile.MaxSpeed > 0 && speed > profile.MaxSpeed {
+		speed = profile.MaxSpeed
+	}
+	return speed
+}
+
+// Penalty See the ref. at Profile interface
+func (profile *VehicleProfile) Penalty(tags osm.Tags) float64 {
+	if v, ok := profile.Penalties[tags.Find(profile.EntityName)]; ok {
+		return v
+	}
+	return 1.0
+}
+
+// NodePenalty See the ref. at Profile interface
+func (profile *VehicleProfile) NodePenalty(tags osm.Tags) (float64, bool) {
+	if len(tags) == 0 {
+		return 0, true
+	}
+	if barrier := tags.Find("barrier"); barrier != "" {
+		level, explicit := explicitAccess(tags, profile.TransportMode)
+		if explicit && level == accessDenied {
+			return 0, false
+		}
+		if !explicit && profile.BlockingBarriers[barrier] {
+			return 0, false
+		}
+	}
+	penalty := 0.0
+	for _, tag := range tags {
+		penalty += profile.NodePenalties[tag.Key+"="+tag.Value]
+	}
+	return penalty, true
+}
+
+// CarProfile Returns built-in profile for personal cars
+func CarProfile() *VehicleProfile {
+	speeds := make(map[string]float64, len(DefaultHighwaySpeeds))
+	for class, speed := range DefaultHighwaySpeeds {
+		speeds[class] = speed
+	}
+	// Those are not used for regular routing of personal cars
+	delete(speeds, "living_street")
+	delete(speeds, "service")
+	delete(speeds, "track")
+	return &VehicleProfile{
+		ProfileName:     "car",
+		TransportMode:   TransportModeCar,
+		EntityName:      "highway",
+		Speeds:          speeds,
+		UseMaxSpeedTags: true,
+		NodePenalties: map[string]float64{
+			"highway=traffic_signals": 15,
+			"highway=stop":            5,
+			"highway=give_way":        2,
+			"highway=crossing":        2,
+			"railway=level_crossing":  10,
+			"barrier=gate":            10,
+			"barrier=lift_gate":       10,
+			"barrier=toll_booth":      30,
+		},
+		BlockingBarriers: map[string]bool{
+			"bollard": true, "block": true, "chain": true, "cycle_barrier": true, "jersey_barrier": true,
+			"kissing_gate": true, "stile": true, "turnstile": true, "fence": true, "wall": true,
+		},
+	}
+}
+
+// HGVProfile Returns built-in profile for heavy goods vehicles (trucks)
+func HGVProfile() *VehicleProfile {
+	profile := CarProfile()
+	profile.ProfileName = "hgv"
+	profile.TransportMode = TransportModeHGV
+	profile.MaxSpeed = 90
+	return profile
+}
+
+// BicycleProfile Returns built-in profile for bicycles
+func BicycleProfile() *VehicleProfile {
+	return &VehicleProfile{
+		ProfileName:   "bicycle",
+		TransportMode: TransportModeBicycle,
+		EntityName:    "highway",
+		Speeds: map[string]float64{
+			"cycleway":       18,
+			"primary":        18,
+			"primary_link":   18,
+			"secondary":      18,
+			"secondary_link": 18,
+			"tertiary":       18,
+			"tertiary_link":  18,
+			"unclassified":   18,
+			"road":           16,
+			"residential":    18,
+			"living_street":  12,
+			"service":        15,
+			"track":          12,
+			"path":           12,
+			"bridleway":      8,
+			"pedestrian":     6,
+			"footway":        6,
+		},
+		Penalties: map[string]float64{
+			"primary":        1.5,
+			"primary_link":   1.5,
+			"secondary":      1.2,
+			"secondary_link": 1.2,
+			"pedestrian":     1.5,
+			"footway":        1.5,
+		},
+		MaxSpeed:        18,
+		UseMaxSpeedTags: true,
+		NodePenalties: map[string]float64{
+			"highway=traffic_signals": 10,
+			"highway=stop":            3,
+			"highway=give_way":        1,
+			"highway=crossing":        2,
+			"railway=level_crossing":  5,
+			"barrier=gate":            5,
+			"barrier=lift_gate":       2,
+			"barrier=bollard":         1,
+			"barrier=cycle_barrier":   5,
+		},
+		BlockingBarriers: map[string]bool{
+			"stile": true, "turnstile": true, "fence": true, "wall": true,
+		},
+	}
+}
+
+// FootProfile Returns built-in profile for pedestrians
+func FootProfile() *VehicleProfile {
+	speeds := map[string]float64{}
+	for _, class := range []string{
+		"primary", "primary_link", "secondary", "secondary_link", "tertiary", "tertiary_link",
+		"unclassified", "road", "residential", "living_street", "service", "track", "path",
+		"cycleway", "bridleway", "pedestrian", "footway", "corridor", "platform",
+	} {
+		speeds[class] = 5
+	}
+	speeds["steps"] = 2
+	return &VehicleProfile{
+		ProfileName:   "foot",
+		TransportMode: TransportModeFoot,
+		EntityName:    "highway",
+		Speeds:        speeds,
+		Penalties: map[string]float64{
+			"primary":      1.3,
+			"primary_link": 1.3,
+			"cycleway":     1.2,
+		},
+		NodePenalties: map[string]float64{
+			"highway=traffic_signals": 10,
+			"railway=level_crossing":  5,
+			"barrier=gate":            2,
+			"barrier=stile":           5,
+			"barrier=turnstile":       2,
+		},
+		BlockingBarriers: map[string]bool{
+			"fence": true, "wall": true,
+		},
+	}
+}
+
+// ProfileByName Returns built-in profile. Supported names are: 'car', 'hgv', 'bicycle', 'foot'
+func ProfileByName(name string) (Profile, error) {
+	switch strings.ToLower(name) {
+	case "car":
+		return CarProfile(), nil
+	case "hgv", "truck":
+		return HGVProfile(), nil
+	case "bicycle", "bike":
+		return BicycleProfile(), nil
+	case "foot", "pedestrian":
+		return FootProfile(), nil
+	default:
+		return nil, fmt.Errorf("Unknown profile: '%s'", name)
+	}
+}
@@ -0,0 +1,252 @@
+package osm2ch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// TagRule Matches ways which have tag with given key. If values are provided then tag value should be one of them
+type TagRule struct {
+	Key    string   `json:"key" yaml:"key"`
+	Values []string `json:"values" yaml:"values"`
+}
+
+// Match Checks if given tags satisfy the rule
+func (rule TagRule) Match(tags osm.Tags) bool {
+	for _, tag := range tags {
+		if tag.Key != rule.Key {
+			continue
+		}
+		if len(rule.Values) == 0 {
+			return true
+		}
+		for _, v := range rule.Values {
+			if tag.Value == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RuleProfile Profile which is extended by include/exclude rules on arbitrary tags and by multipliers for road quality tags
+/*
+	Way is accepted when none of Exclude rules is satisfied and:
+		* at least one of Include rules is satisfied;
+		* or (if there are no Include rules) class of the way is listed in Speeds.
+	Penalty of the way is product of class penalty and multipliers for 'surface', 'smoothness' and 'tracktype' tags
+*/
+type RuleProfile struct {
+	VehicleProfile
+	Include               []TagRule
+	Exclude               []TagRule
+	SurfaceMultipliers    map[string]float64
+	SmoothnessMultipliers map[string]float64
+	TracktypeMultipliers  map[string]float64
+}
+
+// Accept See the ref. at Profile interface
+func (profile *RuleProfile) Accept(tags osm.Tags) bool {
+	for _, rule := range profile.Exclude {
+		if rule.Match(tags) {
+			return false
+		}
+	}
+	if len(profile.Include) == 0 {
+		return profile.VehicleProfile.Accept(tags)
+	}
+	for _, rule := range profile.Include {
+		if rule.Match(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// Penalty See the ref. at Profile interface
+func (profile *RuleProfile) Penalty(tags osm.Tags) float64 {
+	penalty := profile.VehicleProfile.Penalty(tags)
+	if v, ok := profile.SurfaceMultipliers[tags.Find("surface")]; ok {
+		penalty *= v
+	}
+	if v, ok := profile.SmoothnessMultipliers[tags.Find("smoothness")]; ok {
+		penalty *= v
+	}
+	if v, ok := profile.TracktypeMultipliers[tags.Find("tracktype")]; ok {
+		penalty *= v
+	}
+	return penalty
+}
+
+// profileFile Representation of profile file (JSON or YAML)
+type profileFile struct {
+	Name               string             `json:"name" yaml:"name"`
+	Base               string             `json:"base" yaml:"base"`
+	EntityName         string             `json:"entity_name" yaml:"entity_name"`
+	Include            []TagRule          `json:"include" yaml:"include"`
+	Exclude            []TagRule          `json:"exclude" yaml:"exclude"`
+	Speeds             map[string]float64 `json:"speeds" yaml:"speeds"`
+	Penalties          map[string]float64 `json:"penalties" yaml:"penalties"`
+	MaxSpeed           *float64           `json:"max_speed" yaml:"max_speed"`
+	UseMaxSpeedTags    *bool              `json:"use_maxspeed_tags" yaml:"use_maxspeed_tags"`
+	IgnoreOneway       *bool              `json:"ignore_oneway" yaml:"ignore_oneway"`
+	NodePenalties      map[string]float64 `json:"node_penalties" yaml:"node_penalties"`
+	BlockingBarriers   []string           `json:"blocking_barriers" yaml:"blocking_barriers"`
+	Surface            map[string]float64 `json:"surface" yaml:"surface"`
+	Smoothness         map[string]float64 `json:"smoothness" yaml:"smoothness"`
+	Tracktype          map[string]float64 `json:"tracktype" yaml:"tracktype"`
+	TurnPenalty        float64            `json:"turn_penalty" yaml:"turn_penalty"`
+	TurnCosts          TurnCosts          `json:"turn_costs" yaml:"turn_costs"`
+	Destination        string             `json:"destination" yaml:"destination"`
+	DestinationPenalty float64            `json:"destination_penalty" yaml:"destination_penalty"`
+}
+
+// LoadConfiguration Reads configuration from profile file
+/*
+	File should be in JSON (*.json extension) or YAML format. Example of YAML file:
+
+		name: my_car
+		base: car          # built-in profile which is used for missing fields
+		include:
+		  - key: highway
+		    values: [motorway, trunk, primary, secondary, tertiary, residential]
+		exclude:
+		  - key: access
+		    values: ["no", private]
+		speeds:            # default speeds (km/h) for classes of ways
+		  residential: 20
+		penalties:         # multipliers for travel time for classes of ways
+		  residential: 1.5
+		surface:           # multipliers for travel time for values of 'surface' tag
+		  gravel: 1.5
+		smoothness:
+		  bad: 1.3
+		tracktype:
+		  grade3: 1.5
+		node_penalties:    # seconds which are added when passing through nodes with given tags
+		  highway=traffic_signals: 20
+		blocking_barriers: [bollard, block]   # values of 'barrier' tag which can't be passed
+		turn_penalty: 5    # seconds which are added when moving from one way to another
+		turn_costs:        # seconds which are added depending on turn angle
+		  left: 10
+		  right: 3
+		  sharp_left: 15
+		  sharp_right: 8
+		  u_turn: 30
+		  left_hand_traffic: false
+		destination: penalty       # treatment of 'access=destination' / 'access=delivery': 'penalty' or 'exclude'
+		destination_penalty: 2.0   # multiplier for travel time along such ways
+*/
+func LoadConfiguration(fileName string) (*OsmConfiguration, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't read profile file")
+	}
+	spec := profileFile{}
+	if strings.ToLower(filepath.Ext(fileName)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&spec)
+	} else {
+		err = yaml.UnmarshalStrict(data, &spec)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't parse profile file")
+	}
+	profile, err := spec.prepareProfile()
+	if err != nil {
+		return nil, err
+	}
+	destinationAccess, err := ParseDestinationPolicy(spec.Destination)
+	if err != nil {
+		return nil, err
+	}
+	return &OsmConfiguration{
+		EntityName:         profile.EntityName,
+		Profile:            profile,
+		TurnPenalty:        spec.TurnPenalty,
+		TurnCosts:          spec.TurnCosts,
+		DestinationAccess:  destinationAccess,
+		DestinationPenalty: spec.DestinationPenalty,
+	}, nil
+}
+
+// prepareProfile Creates profile from file representation
+func (spec *profileFile) prepareProfile() (*RuleProfile, error) {
+	base := spec.Base
+	if base == "" {
+		base = "car"
+	}
+	baseProfile, err := ProfileByName(base)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't prepare base profile")
+	}
+	vehicleProfile, ok := baseProfile.(*VehicleProfile)
+	if !ok {
+		return nil, fmt.Errorf("Profile '%s' can't be used as base profile", base)
+	}
+	profile := &RuleProfile{
+		VehicleProfile:        *vehicleProfile,
+		Include:               spec.Include,
+		Exclude:               spec.Exclude,
+		SurfaceMultipliers:    spec.Surface,
+		SmoothnessMultipliers: spec.Smoothness,
+		TracktypeMultipliers:  spec.Tracktype,
+	}
+	if spec.Name != "" {
+		profile.ProfileName = spec.Name
+	}
+	if spec.EntityName != "" {
+		profile.EntityName = spec.EntityName
+	}
+	for class, speed := range spec.Speeds {
+		if speed <= 0 {
+			return nil, fmt.Errorf("Speed for '%s' should be positive, but got %f", class, speed)
+		}
+		profile.Speeds[class] = speed
+	}
+	if spec.Penalties != nil {
+		penalties := make(map[string]float64, len(profile.Penalties)+len(spec.Penalties))
+		for class, penalty := range profile.Penalties {
+			penalties[class] = penalty
+		}
+		for class, penalty := range spec.Penalties {
+			penalties[class] = penalty
+		}
+		profile.Penalties = penalties
+	}
+	if spec.NodePenalties != nil {
+		nodePenalties := make(map[string]float64, len(profile.NodePenalties)+len(spec.NodePenalties))
+		for tag, penalty := range profile.NodePenalties {
+			nodePenalties[tag] = penalty
+		}
+		for tag, penalty := range spec.NodePenalties {
+			nodePenalties[tag] = penalty
+		}
+		profile.NodePenalties = nodePenalties
+	}
+	if spec.BlockingBarriers != nil {
+		profile.BlockingBarriers = make(map[string]bool, len(spec.BlockingBarriers))
+		for _, barrier := range spec.BlockingBarriers {
+			profile.BlockingBarriers[barrier] = true
+		}
+	}
+	if spec.MaxSpeed != nil {
+		profile.MaxSpeed = *spec.MaxSpeed
+	}
+	if spec.UseMaxSpeedTags != nil {
+		profile.UseMaxSpeedTags = *spec.UseMaxSpeedTags
+	}
+	if spec.IgnoreOneway != nil {
+		profile.IgnoreOneway = *spec.IgnoreOneway
+	}
+	return profile, nil
+}
@@ -0,0 +1,42 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestLoadConfiguration(t *testing.T) {
+	cfg, err := LoadConfiguration("testdata/profile.yaml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if cfg.TurnPenalty != 3 {
+		t.Errorf("Turn penalty should be %f, but got %f", 3.0, cfg.TurnPenalty)
+	}
+	profile := cfg.Profile
+	if profile.Name() != "test_bicycle" || profile.Mode() != TransportModeBicycle {
+		t.Errorf("Profile should be 'test_bicycle' for bicycles, but got '%s' for %s", profile.Name(), profile.Mode())
+	}
+	track := osm.Tags{{Key: "highway", Value: "track"}, {Key: "surface", Value: "gravel"}, {Key: "tracktype", Value: "grade3"}}
+	if !profile.Accept(track) {
+		t.Errorf("Track should be accepted")
+	}
+	if speed := profile.Speed(track, true); speed != 10 {
+		t.Errorf("Speed on track should be %f, but got %f", 10.0, speed)
+	}
+	if penalty := profile.Penalty(track); penalty != 3 {
+		t.Errorf("Penalty on track should be %f, but got %f", 3.0, penalty)
+	}
+	residential := osm.Tags{{Key: "highway", Value: "residential"}}
+	if penalty := profile.Penalty(residential); penalty != 1.2 {
+		t.Errorf("Penalty on residential should be %f, but got %f", 1.2, penalty)
+	}
+	if profile.Accept(append(residential, osm.Tag{Key: "access", Value: "no"})) {
+		t.Errorf("Residential with 'access=no' should be rejected")
+	}
+	if profile.Accept(osm.Tags{{Key: "highway", Value: "primary"}}) {
+		t.Errorf("Primary should be rejected since it is not included")
+	}
+}
@@ -0,0 +1,116 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestVehicleProfile(t *testing.T) {
+	highway := func(class string, extra ...osm.Tag) osm.Tags {
+		return append(osm.Tags{{Key: "highway", Value: class}}, extra...)
+	}
+	tests := []struct {
+		profile         *VehicleProfile
+		tags            osm.Tags
+		accepted        bool
+		forwardSpeed    float64
+		backwardSpeed   float64
+		expectedPenalty float64
+	}{
+		{CarProfile(), highway("primary"), true, 65, 65, 1},
+		{CarProfile(), highway("primary", osm.Tag{Key: "maxspeed", Value: "50"}), true, 50, 50, 1},
+		{CarProfile(), highway("primary", osm.Tag{Key: "maxspeed:backward", Value: "30 mph"}), true, 65, 30 * mphToKmh, 1},
+		// Classes which are not accepted get fallback speed
+		{CarProfile(), highway("service"), false, fallbackSpeed, fallbackSpeed, 1},
+		{CarProfile(), highway("footway"), false, fallbackSpeed, fallbackSpeed, 1},
+		{CarProfile(), osm.Tags{{Key: "building", Value: "yes"}}, false, fallbackSpeed, fallbackSpeed, 1},
+		{HGVProfile(), highway("motorway"), true, 90, 90, 1},
+		{HGVProfile(), highway("primary", osm.Tag{Key: "maxspeed", Value: "120"}), true, 90, 90, 1},
+		{BicycleProfile(), highway("cycleway"), true, 18, 18, 1},
+		{BicycleProfile(), highway("primary", osm.Tag{Key: "maxspeed", Value: "60"}), true, 18, 18, 1.5},
+		{BicycleProfile(), highway("living_street"), true, 12, 12, 1},
+		// Fallback speed is bounded by MaxSpeed of profile too
+		{BicycleProfile(), highway("motorway"), false, 18, 18, 1},
+		{FootProfile(), highway("footway"), true, 5, 5, 1},
+		{FootProfile(), highway("steps"), true, 2, 2, 1},
+		{FootProfile(), highway("primary", osm.Tag{Key: "maxspeed", Value: "60"}), true, 5, 5, 1.3},
+		{FootProfile(), highway("motorway"), false, fallbackSpeed, fallbackSpeed, 1},
+	}
+	for i, test := range tests {
+		if accepted := test.profile.Accept(test.tags); accepted != test.accepted {
+			t.Errorf("Test %d (%s): accepted should be %t, but got %t", i, test.profile.Name(), test.accepted, accepted)
+		}
+		if speed := test.profile.Speed(test.tags, true); Round(speed, 0.0005) != Round(test.forwardSpeed, 0.0005) {
+			t.Errorf("Test %d (%s): forward speed should be %f, but got %f", i, test.profile.Name(), test.forwardSpeed, speed)
+		}
+		if speed := test.profile.Speed(test.tags, false); Round(speed, 0.0005) != Round(test.backwardSpeed, 0.0005) {
+			t.Errorf("Test %d (%s): backward speed should be %f, but got %f", i, test.profile.Name(), test.backwardSpeed, speed)
+		}
+		if penalty := test.profile.Penalty(test.tags); penalty != test.expectedPenalty {
+			t.Errorf("Test %d (%s): penalty should be %f, but got %f", i, test.profile.Name(), test.expectedPenalty, penalty)
+		}
+	}
+}
+
+func TestProfileByName(t *testing.T) {
+	tests := []struct {
+		name         string
+		expectedName string
+		expectedMode TransportMode
+	}{
+		{"car", "car", TransportModeCar},
+		{"CAR", "car", TransportModeCar},
+		{"hgv", "hgv", TransportModeHGV},
+		{"truck", "hgv", TransportModeHGV},
+		{"bicycle", "bicycle", TransportModeBicycle},
+		{"bike", "bicycle", TransportModeBicycle},
+		{"foot", "foot", TransportModeFoot},
+		{"pedestrian", "foot", TransportModeFoot},
+	}
+	for _, test := range tests {
+		profile, err := ProfileByName(test.name)
+		if err != nil {
+			t.Errorf("Profile '%s' should be found: %v", test.name, err)
+			continue
+		}
+		if profile.Name() != test.expectedName || profile.Mode() != test.expectedMode {
+			t.Errorf("Profile '%s' should be '%s' (%s), but got '%s' (%s)", test.name, test.expectedName, test.expectedMode, profile.Name(), profile.Mode())
+		}
+	}
+	for _, name := range []string{"", "bus", "cars"} {
+		if _, err := ProfileByName(name); err == nil {
+			t.Errorf("Profile '%s' should not be found", name)
+		}
+	}
+}
+
+func TestConfigurationProfileTags(t *testing.T) {
+	cfg := &OsmConfiguration{Tags: []string{"primary", "footway"}}
+	profile := cfg.profile()
+	tests := []struct {
+		class         string
+		accepted      bool
+		expectedSpeed float64
+	}{
+		{"primary", true, 65},
+		// Classes which are not supported by car profile or which are not listed get fallback speed
+		{"footway", true, fallbackSpeed},
+		{"secondary", false, fallbackSpeed},
+		{"residential", false, fallbackSpeed},
+	}
+	for _, test := range tests {
+		tags := osm.Tags{{Key: "highway", Value: test.class}}
+		if accepted := profile.Accept(tags); accepted != test.accepted {
+			t.Errorf("Class '%s': accepted should be %t, but got %t", test.class, test.accepted, accepted)
+		}
+		if speed := profile.Speed(tags, true); speed != test.expectedSpeed {
+			t.Errorf("Class '%s': speed should be %f, but got %f", test.class, test.expectedSpeed, speed)
+		}
+	}
+	// Tags are ignored when profile is set explicitly
+	cfg.Profile = FootProfile()
+	if !cfg.profile().Accept(osm.Tags{{Key: "highway", Value: "residential"}}) {
+		t.Errorf("Explicit profile should not be restricted by tags of configuration")
+	}
+}
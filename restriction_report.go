@@ -0,0 +1,155 @@
+package osm2ch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// RestrictionOutcome Result of processing of restriction relation
+type RestrictionOutcome uint16
+
+const (
+	// Restriction has supported set of members, but it has not been applied to graph yet
+	RestrictionPending = RestrictionOutcome(iota)
+	// Restriction has been applied to edge expanded graph
+	RestrictionApplied
+	// Restriction has no 'from', 'to' or 'via' members, or it has several 'from' / 'to' members while its type is not 'no_entry' / 'no_exit'
+	RestrictionWrongMemberCount
+	// Restriction has members with unknown roles (only 'from', 'to' and 'via' are supported) and it lacks some of known ones
+	RestrictionUnknownRole
+	// Members have unsupported types: 'from' and 'to' should be ways, 'via' should be either single node or ways
+	RestrictionWrongMemberType
+	// Type of restriction is unknown (e.g. misspelled)
+	RestrictionUnsupportedType
+	// Restriction is not applicable for transport mode of profile (e.g. vehicle specific restriction or 'except' tag)
+	RestrictionOtherMode
+	// Some of member ways are not part of graph: they have been filtered out by profile or by clipping, or they are missing in data
+	RestrictionMemberFiltered
+	// Member ways are part of graph, but they are not connected in the way which restriction describes
+	RestrictionNotMatched
+	// Restrictions are not supported by node based graph (see the ref. at GraphModeNode)
+	RestrictionNodeBasedGraph
+	// Restriction matches graph, but it doesn't remove any turn: e.g. 'only_*' restriction for the only possible turn
+	// or restriction which duplicates previous ones
+	RestrictionNoEffect
+)
+
+// String returns pretty printed value for RestrictionOutcome
+func (outcome RestrictionOutcome) String() string {
+	switch outcome {
+	case RestrictionPending:
+		return "pending"
+	case RestrictionApplied:
+		return "applied"
+	case RestrictionWrongMemberCount:
+		return "wrong_member_count"
+	case RestrictionUnknownRole:
+		return "unknown_role"
+	case RestrictionWrongMemberType:
+		return "wrong_member_type"
+	case RestrictionUnsupportedType:
+		return "unsupported_type"
+	case RestrictionOtherMode:
+		return "other_mode"
+	case RestrictionMemberFiltered:
+		return "member_filtered_out"
+	case RestrictionNotMatched:
+		return "not_matched"
+	case RestrictionNodeBasedGraph:
+		return "node_based_graph"
+	case RestrictionNoEffect:
+		return "no_effect"
+	default:
+		return fmt.Sprintf("unknown(%d)", outcome)
+	}
+}
+
+// RestrictionReport Diagnostics of single restriction relation
+type RestrictionReport struct {
+	ID osm.RelationID
+	// Type of restriction, e.g. 'no_left_turn'
+	Type string
+	// Members of relation (type, reference and role only)
+	Members osm.Members
+	Outcome RestrictionOutcome
+	// Identifiers of expanded edges which have been removed by restriction.
+	// For restrictions with via ways those are outcoming edges of duplicated vertices (see the ref. at turnGraph)
+	RemovedExpandedEdges []int64
+}
+
+// restrictionResult Outcome of applying of single restriction to graph
+type restrictionResult struct {
+	id      osm.RelationID
+	outcome RestrictionOutcome
+	removed []int64
+}
+
+// restrictionDiagnostics Reports of restriction relations by their IDs. Nil value doesn't collect anything (diagnostics is disabled)
+type restrictionDiagnostics map[osm.RelationID]*RestrictionReport
+
+// add Keeps report of relation with given outcome. Report of previous version of relation is replaced
+func (diagnostics restrictionDiagnostics) add(relation *osm.Relation, restrictionType string, outcome RestrictionOutcome) {
+	if diagnostics == nil {
+		return
+	}
+	members := make(osm.Members, len(relation.Members))
+	for i, member := range relation.Members {
+		members[i] = osm.Member{Type: member.Type, Ref: member.Ref, Role: member.Role}
+	}
+	diagnostics[relation.ID] = &RestrictionReport{
+		ID:      relation.ID,
+		Type:    restrictionType,
+		Members: members,
+		Outcome: outcome,
+	}
+}
+
+// addResults Sets outcomes of restrictions which have been applied to graph
+func (diagnostics restrictionDiagnostics) addResults(results []restrictionResult) {
+	for _, result := range results {
+		if report, ok := diagnostics[result.id]; ok {
+			report.Outcome = result.outcome
+			report.RemovedExpandedEdges = result.removed
+		}
+	}
+}
+
+// resolvePending Sets given outcome for restrictions which have not been applied to graph
+func (diagnostics restrictionDiagnostics) resolvePending(outcome RestrictionOutcome) {
+	for _, report := range diagnostics {
+		if report.Outcome == RestrictionPending {
+			report.Outcome = outcome
+		}
+	}
+}
+
+// reports Returns reports sorted by ID of relation. Returns nil when diagnostics is disabled
+func (diagnostics restrictionDiagnostics) reports() []RestrictionReport {
+	if diagnostics == nil {
+		return nil
+	}
+	ans := make([]RestrictionReport, 0, len(diagnostics))
+	for _, report := range diagnostics {
+		ans = append(ans, *report)
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].ID < ans[j].ID
+	})
+	return ans
+}
+
+// anyRestrictionType Returns value of 'restriction' tag or of the first vehicle specific one ('restriction:hgv' and etc.)
+func anyRestrictionType(tags osm.Tags) string {
+	if restrictionType := tags.Find("restriction"); restrictionType != "" {
+		return restrictionType
+	}
+	for _, tag := range tags {
+		if strings.HasPrefix(tag.Key, "restriction:") {
+			return tag.Value
+		}
+	}
+	return ""
+}
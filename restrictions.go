@@ -0,0 +1,559 @@
+package osm2ch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// restrictionComponent represents member of restriction relation. Could be either way or node.
+type restrictionComponent struct {
+	ID   int64
+	Type string
+}
+
+// restriction represents turn restriction relation
+/*
+	Via is either single node or sequence of ways (in order of travelling from 'from' way to 'to' way)
+*/
+type restriction struct {
+	ID   osm.RelationID
+	Type string
+	From []restrictionComponent
+	Via  []restrictionComponent
+	To   []restrictionComponent
+}
+
+// viaNode Checks if restriction has form of way(from) - node(via) - way(to)
+func (r *restriction) viaNode() bool {
+	return len(r.Via) == 1 && r.Via[0].Type == "node"
+}
+
+// combo Returns types of members in form 'from;to;via'
+func (r *restriction) combo() string {
+	types := func(components []restrictionComponent) string {
+		ans := make([]string, len(components))
+		for i := range components {
+			ans[i] = components[i].Type
+		}
+		return strings.Join(ans, ",")
+	}
+	return fmt.Sprintf("%s;%s;%s", types(r.From), types(r.To), types(r.Via))
+}
+
+// parseRestriction Prepares restriction from relation. Returns number of members with unknown roles and
+// RestrictionPending if relation has supported set of members (or reason why it is unsupported otherwise)
+/*
+	Supported sets of members are:
+		* way(from) - node(via) - way(to);
+		* way(from) - one or more way(via) - way(to).
+	Restrictions of 'no_entry' type could have multiple 'from' members and restrictions of 'no_exit' type could have multiple 'to' members
+*/
+func parseRestriction(relation *osm.Relation, restrictionType string) (restriction, int, RestrictionOutcome) {
+	r := restriction{
+		ID:   relation.ID,
+		Type: restrictionType,
+	}
+	unsupportedRoles := 0
+	for _, member := range relation.Members {
+		component := restrictionComponent{member.Ref, string(member.Type)}
+		switch member.Role {
+		case "from":
+			r.From = append(r.From, component)
+		case "via":
+			r.Via = append(r.Via, component)
+		case "to":
+			r.To = append(r.To, component)
+		default:
+			unsupportedRoles++
+		}
+	}
+	if len(r.From) == 0 || len(r.To) == 0 || len(r.Via) == 0 {
+		// Missing member could have misspelled role
+		if unsupportedRoles > 0 {
+			return r, unsupportedRoles, RestrictionUnknownRole
+		}
+		return r, unsupportedRoles, RestrictionWrongMemberCount
+	}
+	if len(r.From) > 1 && restrictionType != "no_entry" {
+		return r, unsupportedRoles, RestrictionWrongMemberCount
+	}
+	if len(r.To) > 1 && restrictionType != "no_exit" {
+		return r, unsupportedRoles, RestrictionWrongMemberCount
+	}
+	for _, from := range r.From {
+		if from.Type != "way" {
+			return r, unsupportedRoles, RestrictionWrongMemberType
+		}
+	}
+	for _, to := range r.To {
+		if to.Type != "way" {
+			return r, unsupportedRoles, RestrictionWrongMemberType
+		}
+	}
+	if r.viaNode() {
+		return r, unsupportedRoles, RestrictionPending
+	}
+	for _, via := range r.Via {
+		if via.Type != "way" {
+			return r, unsupportedRoles, RestrictionWrongMemberType
+		}
+	}
+	return r, unsupportedRoles, RestrictionPending
+}
+
+// restrictionVehicles Classes of vehicles which are affected by restrictions for each type of transport: from the most specific class to the most generic one
+var restrictionVehicles = map[TransportMode][]string{
+	TransportModeCar:     []string{"motorcar", "motor_vehicle", "vehicle"},
+	TransportModeHGV:     []string{"hgv", "motor_vehicle", "vehicle"},
+	TransportModeBicycle: []string{"bicycle", "vehicle"},
+	TransportModeFoot:    []string{"foot"},
+}
+
+// restrictionTypeForMode Returns type of restriction (e.g. 'no_left_turn') which is applicable for given type of transport. Returns false if restriction is not applicable
+/*
+	Vehicle specific tags ('restriction:hgv', 'restriction:bicycle' and etc.) have the highest priority.
+	Generic 'restriction' tag is not applied to vehicles listed in 'except' tag (e.g. 'except=bicycle;psv') and to pedestrians
+*/
+func restrictionTypeForMode(tags osm.Tags, mode TransportMode) (string, bool) {
+	vehicles := restrictionVehicles[mode]
+	for _, vehicle := range vehicles {
+		if restrictionType := tags.Find("restriction:" + vehicle); restrictionType != "" {
+			return restrictionType, true
+		}
+	}
+	restrictionType := tags.Find("restriction")
+	if restrictionType == "" || mode == TransportModeFoot {
+		return "", false
+	}
+	for _, exception := range strings.Split(tags.Find("except"), ";") {
+		exception = strings.TrimSpace(exception)
+		for _, vehicle := range vehicles {
+			if exception == vehicle {
+				return "", false
+			}
+		}
+	}
+	return restrictionType, true
+}
+
+// restrictionKind Returns true for restrictions of "no" type, false for "only" type. Second value is false for unsupported types
+func restrictionKind(restrictionType string) (bool, bool) {
+	switch restrictionType {
+	case "no_left_turn", "no_right_turn", "no_straight_on", "no_u_turn", "no_entry", "no_exit":
+		return true, true
+	case "only_left_turn", "only_right_turn", "only_straight_on", "only_u_turn":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// turnGraph Edge expanded graph which is being modified by restrictions
+/*
+	Restrictions with via ways can't be expressed by removing single expanded edges (turns), since they forbid
+	sequence of turns. So vertices of such sequence are duplicated: duplicate of a vertex represents the state
+	'vertex has been reached from the beginning of the sequence'. Then the last turn of sequence is removed for
+	duplicate only (or every other turn for "only" type restrictions).
+	Duplicate is owned by the vertex (original or duplicated one) it is reached from, so it represents the whole prefix
+	of the sequence and it is never shared by restrictions with different prefixes. Duplicate copies outcoming turns of
+	the vertex it has been created from, so restrictions which have been applied already are inherited. Restrictions which
+	are applied later start from the original vertex and from every its duplicate.
+*/
+type turnGraph struct {
+	edges      []Edge
+	edgesByWay map[osm.WayID][]int
+	// Nodes of ways. Way could consist of several parts (e.g. when it has been cut by clipping area)
+	wayNodes      map[osm.WayID][]osm.WayNodes
+	expandedEdges []ExpandedEdge
+	deleted       []bool
+	// Indices of expanded edges by source vertex
+	outcoming map[EdgeID][]int
+	// Indices of expanded edges by source OSM way
+	bySourceWay map[osm.WayID][]int
+	// Duplicated vertex -> original vertex
+	originals map[EdgeID]EdgeID
+	// Duplicated vertex -> vertex which it is reached from
+	parents map[EdgeID]EdgeID
+	// Original vertex -> its duplicates
+	duplicates map[EdgeID][]EdgeID
+	// Generator of identifiers for duplicated vertices and their outcoming expanded edges
+	ids idAssigner
+	// Identifiers of expanded edges which have been removed by restriction being applied
+	removed []int64
+	// Outcomes of applied restrictions
+	results []restrictionResult
+}
+
+// newTurnGraph Prepares edge expanded graph for applying restrictions
+func newTurnGraph(ways []Way, edges []Edge, expandedEdges []ExpandedEdge, ids idAssigner) *turnGraph {
+	graph := &turnGraph{
+		edges:         edges,
+		edgesByWay:    make(map[osm.WayID][]int),
+		wayNodes:      make(map[osm.WayID][]osm.WayNodes, len(ways)),
+		expandedEdges: expandedEdges,
+		deleted:       make([]bool, len(expandedEdges)),
+		outcoming:     make(map[EdgeID][]int),
+		bySourceWay:   make(map[osm.WayID][]int),
+		originals:     make(map[EdgeID]EdgeID),
+		parents:       make(map[EdgeID]EdgeID),
+		duplicates:    make(map[EdgeID][]EdgeID),
+		ids:           ids,
+	}
+	for _, way := range ways {
+		graph.wayNodes[way.ID] = append(graph.wayNodes[way.ID], way.Nodes)
+	}
+	for i, edge := range edges {
+		graph.edgesByWay[edge.WayID] = append(graph.edgesByWay[edge.WayID], i)
+	}
+	for i, expEdge := range expandedEdges {
+		graph.outcoming[expEdge.Source] = append(graph.outcoming[expEdge.Source], i)
+		graph.bySourceWay[expEdge.SourceOSMWayID] = append(graph.bySourceWay[expEdge.SourceOSMWayID], i)
+	}
+	return graph
+}
+
+// applyRestrictions Applies restrictions to graph. Returns number of applied restrictions
+/*
+	Restrictions with via node are applied first, so duplicated vertices inherit them.
+	Outcome of every restriction is kept in results of graph. Restriction which matches graph, but hasn't removed any expanded edge
+	(e.g. 'only_*' restriction for the only possible turn or restriction which has been applied by previous ones already) has no effect.
+	Such restrictions are counted as applied ones, since they match graph
+*/
+func (graph *turnGraph) applyRestrictions(restrictions []restriction) int {
+	sort.SliceStable(restrictions, func(i, j int) bool {
+		return restrictions[i].viaNode() && !restrictions[j].viaNode()
+	})
+	applied := 0
+	for i := range restrictions {
+		graph.removed = nil
+		outcome := graph.applyRestriction(&restrictions[i])
+		if outcome == RestrictionApplied && len(graph.removed) == 0 {
+			outcome = RestrictionNoEffect
+		}
+		if outcome == RestrictionApplied || outcome == RestrictionNoEffect {
+			applied++
+		}
+		graph.results = append(graph.results, restrictionResult{id: restrictions[i].ID, outcome: outcome, removed: graph.removed})
+	}
+	graph.removed = nil
+	return applied
+}
+
+// applyRestriction Applies single restriction to graph. Returns RestrictionApplied or reason why restriction is not applicable
+/*
+	Restrictions with multiple 'from' or 'to' members ('no_entry' / 'no_exit') are applied for every pair of 'from' and 'to' ways:
+	restriction is considered as applied if it is applied for at least one pair
+*/
+func (graph *turnGraph) applyRestriction(r *restriction) RestrictionOutcome {
+	prohibitive, ok := restrictionKind(r.Type)
+	if !ok {
+		return RestrictionUnsupportedType
+	}
+	outcome := RestrictionMemberFiltered
+	for _, from := range r.From {
+		for _, to := range r.To {
+			switch graph.applyTurnRestriction(r, osm.WayID(from.ID), osm.WayID(to.ID), prohibitive) {
+			case RestrictionApplied:
+				outcome = RestrictionApplied
+			case RestrictionNotMatched:
+				if outcome != RestrictionApplied {
+					outcome = RestrictionNotMatched
+				}
+			}
+		}
+	}
+	return outcome
+}
+
+// applyTurnRestriction Applies restriction for given pair of 'from' and 'to' ways. Returns RestrictionApplied or reason why restriction is not applicable
+func (graph *turnGraph) applyTurnRestriction(r *restriction, fromOSMWayID, toOSMWayID osm.WayID, prohibitive bool) RestrictionOutcome {
+	if _, ok := graph.wayNodes[fromOSMWayID]; !ok {
+		return RestrictionMemberFiltered
+	}
+	if _, ok := graph.wayNodes[toOSMWayID]; !ok {
+		return RestrictionMemberFiltered
+	}
+	if r.viaNode() {
+		viaNodeID := osm.NodeID(r.Via[0].ID)
+		turns := []int{}
+		restrictedTurns := make(map[int]bool)
+		for _, expEdgeIndex := range graph.bySourceWay[fromOSMWayID] {
+			expEdge := graph.expandedEdges[expEdgeIndex]
+			// Turns which have been removed by previous restrictions are taken into account for matching too
+			if expEdge.SourceComponent.TargetNodeID != viaNodeID {
+				continue
+			}
+			turns = append(turns, expEdgeIndex)
+			restricted := expEdge.TargetOSMWayID == toOSMWayID
+			// U-turn on the same way: continuation of the way through via node is not restricted
+			if (r.Type == "no_u_turn" || r.Type == "only_u_turn") && fromOSMWayID == toOSMWayID {
+				restricted = restricted && expEdge.TargetComponent.TargetNodeID == expEdge.SourceComponent.SourceNodeID
+			}
+			if restricted {
+				restrictedTurns[expEdgeIndex] = true
+			}
+		}
+		// Turn which is described by restriction doesn't exist (e.g. U-turn on the same segment, since such turns are not expanded).
+		// Graph is left untouched then: otherwise "only" type restriction would remove every turn
+		if len(restrictedTurns) == 0 {
+			return RestrictionNotMatched
+		}
+		for _, expEdgeIndex := range turns {
+			if restrictedTurns[expEdgeIndex] == prohibitive {
+				graph.remove(expEdgeIndex)
+			}
+		}
+		return RestrictionApplied
+	}
+	for _, via := range r.Via {
+		if _, ok := graph.wayNodes[osm.WayID(via.ID)]; !ok {
+			return RestrictionMemberFiltered
+		}
+	}
+	applied := false
+	for _, path := range graph.restrictionPaths(r, fromOSMWayID, toOSMWayID) {
+		// Sequence could be started from duplicates of the first vertex too (they keep other restrictions)
+		starts := append([]EdgeID{path[0]}, graph.duplicates[path[0]]...)
+		for _, start := range starts {
+			if graph.applyPath(start, path, prohibitive) {
+				applied = true
+			}
+		}
+	}
+	if !applied {
+		return RestrictionNotMatched
+	}
+	return RestrictionApplied
+}
+
+// restrictionPaths Returns sequences of vertices (original edges) which are described by restriction with via ways
+func (graph *turnGraph) restrictionPaths(r *restriction, fromOSMWayID, toOSMWayID osm.WayID) [][]EdgeID {
+	wayIDs := make([]osm.WayID, 0, len(r.Via)+2)
+	wayIDs = append(wayIDs, fromOSMWayID)
+	for _, via := range r.Via {
+		wayIDs = append(wayIDs, osm.WayID(via.ID))
+	}
+	wayIDs = append(wayIDs, toOSMWayID)
+	for _, wayID := range wayIDs {
+		if _, ok := graph.wayNodes[wayID]; !ok {
+			return nil
+		}
+	}
+	// Find nodes where consecutive ways are connected
+	junctions := make([]osm.NodeID, len(wayIDs)-1)
+	for i := 1; i < len(wayIDs); i++ {
+		exclude := osm.NodeID(-1)
+		if i > 1 {
+			exclude = junctions[i-2]
+		}
+		junction, ok := graph.connection(wayIDs[i-1], wayIDs[i], exclude)
+		if !ok {
+			return nil
+		}
+		junctions[i-1] = junction
+	}
+	// Chain of vertices along via ways
+	via := []EdgeID{}
+	for i := 1; i < len(wayIDs)-1; i++ {
+		chain, ok := graph.wayChain(wayIDs[i], junctions[i-1], junctions[i])
+		if !ok {
+			return nil
+		}
+		via = append(via, chain...)
+	}
+	paths := [][]EdgeID{}
+	for _, fromIdx := range graph.edgesByWay[wayIDs[0]] {
+		from := graph.edges[fromIdx]
+		if from.TargetNodeID != junctions[0] {
+			continue
+		}
+		for _, toIdx := range graph.edgesByWay[wayIDs[len(wayIDs)-1]] {
+			to := graph.edges[toIdx]
+			if to.SourceNodeID != junctions[len(junctions)-1] {
+				continue
+			}
+			path := make([]EdgeID, 0, len(via)+2)
+			path = append(path, from.ID)
+			path = append(path, via...)
+			path = append(path, to.ID)
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// connection Returns node which connects two ways. Every pair of parts of ways is checked
+func (graph *turnGraph) connection(first, second osm.WayID, exclude osm.NodeID) (osm.NodeID, bool) {
+	for _, firstNodes := range graph.wayNodes[first] {
+		for _, secondNodes := range graph.wayNodes[second] {
+			if junction, ok := partsConnection(firstNodes, secondNodes, exclude); ok {
+				return junction, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// partsConnection Returns node which connects two sequences of nodes. Endpoints are preferred
+func partsConnection(firstNodes, secondNodes osm.WayNodes, exclude osm.NodeID) (osm.NodeID, bool) {
+	if len(firstNodes) == 0 || len(secondNodes) == 0 {
+		return 0, false
+	}
+	contains := func(nodes osm.WayNodes, id osm.NodeID) bool {
+		for _, node := range nodes {
+			if node.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+	candidates := []osm.NodeID{
+		secondNodes[0].ID, secondNodes[len(secondNodes)-1].ID,
+		firstNodes[0].ID, firstNodes[len(firstNodes)-1].ID,
+	}
+	for i, candidate := range candidates {
+		if candidate == exclude {
+			continue
+		}
+		if i < 2 && contains(firstNodes, candidate) {
+			return candidate, true
+		}
+		if i >= 2 && contains(secondNodes, candidate) {
+			return candidate, true
+		}
+	}
+	return 0, false
+}
+
+// wayChain Returns sequence of edges along given way from source node to target node
+func (graph *turnGraph) wayChain(wayID osm.WayID, source, target osm.NodeID) ([]EdgeID, bool) {
+	wayEdges := graph.edgesByWay[wayID]
+	for _, startIdx := range wayEdges {
+		if graph.edges[startIdx].SourceNodeID != source {
+			continue
+		}
+		chain := []EdgeID{graph.edges[startIdx].ID}
+		current := graph.edges[startIdx]
+		for steps := 0; current.TargetNodeID != target && steps < len(wayEdges); steps++ {
+			found := false
+			for _, nextIdx := range wayEdges {
+				next := graph.edges[nextIdx]
+				if next.SourceNodeID == current.TargetNodeID && next.TargetNodeID != current.SourceNodeID {
+					chain = append(chain, next.ID)
+					current = next
+					found = true
+					break
+				}
+			}
+			if !found {
+				break
+			}
+		}
+		if current.TargetNodeID == target {
+			return chain, true
+		}
+	}
+	return nil, false
+}
+
+// original Returns original vertex for given (possibly duplicated) vertex
+func (graph *turnGraph) original(vertex EdgeID) EdgeID {
+	if original, ok := graph.originals[vertex]; ok {
+		return original
+	}
+	return vertex
+}
+
+// duplicateVertex Creates copy of vertex (which is reached from parent vertex) with copies of its outcoming expanded edges. Returns ID of new vertex
+/*
+	Vertex could be duplicate itself: then new duplicate inherits restrictions which have been applied to it
+*/
+func (graph *turnGraph) duplicateVertex(parent, vertex EdgeID) EdgeID {
+	original := graph.original(vertex)
+	duplicate := graph.ids.duplicateID(parent, original)
+	graph.originals[duplicate] = original
+	graph.parents[duplicate] = parent
+	graph.duplicates[original] = append(graph.duplicates[original], duplicate)
+	for _, expEdgeIndex := range graph.outcoming[vertex] {
+		if graph.deleted[expEdgeIndex] {
+			continue
+		}
+		expEdge := graph.expandedEdges[expEdgeIndex]
+		expEdge.ID = graph.ids.expandedEdgeID(duplicate, expEdge.Target)
+		expEdge.Source = duplicate
+		expEdge.Geom = copyLine(expEdge.Geom)
+		graph.expandedEdges = append(graph.expandedEdges, expEdge)
+		graph.deleted = append(graph.deleted, false)
+		newIndex := len(graph.expandedEdges) - 1
+		graph.outcoming[duplicate] = append(graph.outcoming[duplicate], newIndex)
+		graph.bySourceWay[expEdge.SourceOSMWayID] = append(graph.bySourceWay[expEdge.SourceOSMWayID], newIndex)
+	}
+	return duplicate
+}
+
+// applyPath Forbids (prohibitive == true) or makes mandatory given sequence of vertices for traffic which starts it from given vertex
+// (the first vertex of sequence or its duplicate). Returns false if sequence does not exist in graph
+func (graph *turnGraph) applyPath(start EdgeID, path []EdgeID, prohibitive bool) bool {
+	current := start
+	for i := 1; i < len(path); i++ {
+		next := path[i]
+		turnIndex := -1
+		for _, expEdgeIndex := range graph.outcoming[current] {
+			if graph.deleted[expEdgeIndex] {
+				continue
+			}
+			if graph.original(graph.expandedEdges[expEdgeIndex].Target) == next {
+				turnIndex = expEdgeIndex
+				break
+			}
+		}
+		if turnIndex < 0 {
+			// Sequence does not exist in graph
+			return false
+		}
+		if !prohibitive {
+			for _, expEdgeIndex := range graph.outcoming[current] {
+				if expEdgeIndex != turnIndex {
+					graph.remove(expEdgeIndex)
+				}
+			}
+		}
+		if i == len(path)-1 {
+			if prohibitive {
+				graph.remove(turnIndex)
+			}
+			return true
+		}
+		// Duplicate which is reached from another vertex represents another prefix of sequence, so it can't be reused
+		target := graph.expandedEdges[turnIndex].Target
+		if parent, ok := graph.parents[target]; !ok || parent != current {
+			target = graph.duplicateVertex(current, target)
+			graph.expandedEdges[turnIndex].Target = target
+		}
+		current = target
+	}
+	return true
+}
+
+// remove Deletes expanded edge and remembers its identifier for results of restriction being applied
+func (graph *turnGraph) remove(expEdgeIndex int) {
+	if graph.deleted[expEdgeIndex] {
+		return
+	}
+	graph.deleted[expEdgeIndex] = true
+	graph.removed = append(graph.removed, graph.expandedEdges[expEdgeIndex].ID)
+}
+
+// result Returns expanded edges which have not been deleted
+func (graph *turnGraph) result() []ExpandedEdge {
+	ans := make([]ExpandedEdge, 0, len(graph.expandedEdges))
+	for i, expEdge := range graph.expandedEdges {
+		if !graph.deleted[i] {
+			ans = append(ans, expEdge)
+		}
+	}
+	return ans
+}
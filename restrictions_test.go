@@ -0,0 +1,423 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+// prepareTestEdges Creates edge for every pair of consecutive nodes of given ways
+func prepareTestEdges(ways []Way, coords map[osm.NodeID]GeoPoint) []Edge {
+	edges := []Edge{}
+	for _, way := range ways {
+		for i := 1; i < len(way.Nodes); i++ {
+			source, target := way.Nodes[i-1].ID, way.Nodes[i].ID
+			geom := []GeoPoint{coords[source], coords[target]}
+			if way.Direction.Forward() {
+				edges = append(edges, Edge{ID: EdgeID(len(edges) + 1), WayID: way.ID, SourceNodeID: source, TargetNodeID: target, Geom: geom})
+			}
+			if way.Direction.Backward() {
+				edges = append(edges, Edge{ID: EdgeID(len(edges) + 1), WayID: way.ID, SourceNodeID: target, TargetNodeID: source, Geom: reverseLine(geom)})
+			}
+		}
+	}
+	return edges
+}
+
+// expandTestEdges Expands edges and enumerates expanded edges in the same way as import does
+func expandTestEdges(edges []Edge) ([]ExpandedEdge, idAssigner) {
+	ids := &sequentialIDs{}
+	ids.assignEdges(edges)
+	expandedEdges, _ := expandEdges(edges, nil, &OsmConfiguration{})
+	ids.assignExpandedEdges(expandedEdges)
+	return expandedEdges, ids
+}
+
+// reachable Returns set of vertices which are reachable from given one
+func reachable(expandedEdges []ExpandedEdge, source EdgeID) map[EdgeID]bool {
+	outcoming := make(map[EdgeID][]EdgeID)
+	for _, expEdge := range expandedEdges {
+		outcoming[expEdge.Source] = append(outcoming[expEdge.Source], expEdge.Target)
+	}
+	visited := map[EdgeID]bool{source: true}
+	queue := []EdgeID{source}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range outcoming[current] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return visited
+}
+
+// prepareDividedRoad Returns ways of divided road with crossing of the median:
+/*
+	1 --(10)--> 2 --(10)--> 3
+	            |
+	           (30)
+	            |
+	4 <--(20)-- 5 <--(20)-- 6
+*/
+func prepareDividedRoad() ([]Way, []Edge) {
+	coords := map[osm.NodeID]GeoPoint{
+		1: {Lon: 0, Lat: 0}, 2: {Lon: 0.001, Lat: 0}, 3: {Lon: 0.002, Lat: 0},
+		4: {Lon: 0, Lat: -0.001}, 5: {Lon: 0.001, Lat: -0.001}, 6: {Lon: 0.002, Lat: -0.001},
+	}
+	ways := []Way{
+		{ID: 10, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+		{ID: 20, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 6}, {ID: 5}, {ID: 4}}},
+		{ID: 30, Direction: DirectionBoth, Nodes: osm.WayNodes{{ID: 2}, {ID: 5}}},
+	}
+	return ways, prepareTestEdges(ways, coords)
+}
+
+func TestViaNodeRestriction(t *testing.T) {
+	ways, edges := prepareDividedRoad()
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "no_right_turn",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{2, "node"}},
+		To:   []restrictionComponent{{30, "way"}},
+	}})
+	if applied != 1 {
+		t.Errorf("Restriction should be applied")
+	}
+	result := graph.result()
+	// Edge 1 is 1->2 and edge 5 is 2->5
+	if reachable(result, 1)[5] {
+		t.Errorf("Turn from way 10 to way 30 should be prohibited")
+	}
+	if !reachable(result, 1)[2] {
+		t.Errorf("Way 10 should be passable")
+	}
+}
+
+func TestViaWayRestriction(t *testing.T) {
+	ways, edges := prepareDividedRoad()
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "no_left_turn",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{30, "way"}},
+		To:   []restrictionComponent{{20, "way"}},
+	}})
+	if applied != 1 {
+		t.Errorf("Restriction should be applied")
+	}
+	result := graph.result()
+	// Edge 1 is 1->2, edge 4 is 5->4, edge 3 is 6->5
+	if reachable(result, 1)[4] {
+		t.Errorf("U-turn from way 10 to way 20 through way 30 should be prohibited")
+	}
+	if !reachable(result, 3)[4] {
+		t.Errorf("Way 20 should be passable")
+	}
+
+	expandedEdges, ids = expandTestEdges(edges)
+	graph = newTurnGraph(ways, edges, expandedEdges, ids)
+	graph.applyRestrictions([]restriction{{
+		ID:   2,
+		Type: "only_left_turn",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{30, "way"}},
+		To:   []restrictionComponent{{20, "way"}},
+	}})
+	result = graph.result()
+	visited := reachable(result, 1)
+	if !visited[4] {
+		t.Errorf("U-turn from way 10 to way 20 through way 30 should be allowed")
+	}
+	// Edge 2 is 2->3
+	if visited[2] {
+		t.Errorf("Going straight on way 10 should be prohibited")
+	}
+}
+
+// prepareChainedRoads Returns oneway ways where restrictions with via ways overlap:
+/*
+	1 --(10)--> 2 --(30)--> 3 --(40)--> 4 --(50)--> 5
+	            ^           |           |
+	          (20)        (70)        (60)
+	            |           v           v
+	            9           7           6
+*/
+func prepareChainedRoads() ([]Way, []Edge) {
+	coords := map[osm.NodeID]GeoPoint{
+		1: {Lon: 0, Lat: 0}, 2: {Lon: 0.001, Lat: 0}, 3: {Lon: 0.002, Lat: 0}, 4: {Lon: 0.003, Lat: 0}, 5: {Lon: 0.004, Lat: 0},
+		6: {Lon: 0.003, Lat: -0.001}, 7: {Lon: 0.002, Lat: -0.001}, 9: {Lon: 0.001, Lat: -0.001},
+	}
+	ways := []Way{
+		{ID: 10, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		{ID: 20, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 9}, {ID: 2}}},
+		{ID: 30, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 2}, {ID: 3}}},
+		{ID: 40, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 3}, {ID: 4}}},
+		{ID: 50, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 4}, {ID: 5}}},
+		{ID: 60, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 4}, {ID: 6}}},
+		{ID: 70, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 3}, {ID: 7}}},
+	}
+	return ways, prepareTestEdges(ways, coords)
+}
+
+func TestOverlappingViaWayRestrictions(t *testing.T) {
+	ways, edges := prepareChainedRoads()
+	// Edges: 1 is way 10, 2 is way 20, 5 is way 50, 6 is way 60, 7 is way 70
+	noRightTurn := restriction{
+		ID:   1,
+		Type: "no_right_turn",
+		From: []restrictionComponent{{30, "way"}},
+		Via:  []restrictionComponent{{40, "way"}},
+		To:   []restrictionComponent{{60, "way"}},
+	}
+	noStraightOn := restriction{
+		ID:   2,
+		Type: "no_straight_on",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{30, "way"}, {40, "way"}},
+		To:   []restrictionComponent{{50, "way"}},
+	}
+	// Result should not depend on order of restrictions
+	for _, restrictions := range [][]restriction{{noRightTurn, noStraightOn}, {noStraightOn, noRightTurn}} {
+		expandedEdges, ids := expandTestEdges(edges)
+		graph := newTurnGraph(ways, edges, expandedEdges, ids)
+		applied := graph.applyRestrictions(restrictions)
+		if applied != 2 {
+			t.Errorf("Both restrictions should be applied, but got %d", applied)
+		}
+		result := graph.result()
+		fromWay10 := reachable(result, 1)
+		if fromWay10[5] || fromWay10[6] {
+			t.Errorf("Way 10 should not lead to ways 50 and 60 through ways 30 and 40")
+		}
+		if !fromWay10[7] {
+			t.Errorf("Way 10 should lead to way 70")
+		}
+		fromWay20 := reachable(result, 2)
+		if !fromWay20[5] {
+			t.Errorf("Way 20 should lead to way 50: restriction from way 10 should not affect it")
+		}
+		if fromWay20[6] {
+			t.Errorf("Way 20 should not lead to way 60 through ways 30 and 40")
+		}
+	}
+}
+
+func TestChainedViaWayRestrictions(t *testing.T) {
+	ways, edges := prepareChainedRoads()
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	// The first restriction duplicates vertex of way 30, the second one should be applied to that duplicate too
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "only_straight_on",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{30, "way"}},
+		To:   []restrictionComponent{{40, "way"}},
+	}, {
+		ID:   2,
+		Type: "no_right_turn",
+		From: []restrictionComponent{{30, "way"}},
+		Via:  []restrictionComponent{{40, "way"}},
+		To:   []restrictionComponent{{60, "way"}},
+	}})
+	if applied != 2 {
+		t.Errorf("Both restrictions should be applied, but got %d", applied)
+	}
+	result := graph.result()
+	fromWay10 := reachable(result, 1)
+	if fromWay10[7] {
+		t.Errorf("Way 10 should not lead to way 70")
+	}
+	if fromWay10[6] {
+		t.Errorf("Way 10 should not lead to way 60 through ways 30 and 40")
+	}
+	if !fromWay10[5] {
+		t.Errorf("Way 10 should lead to way 50")
+	}
+	fromWay20 := reachable(result, 2)
+	if !fromWay20[7] || !fromWay20[5] || fromWay20[6] {
+		t.Errorf("Way 20 should lead to ways 50 and 70, but not to way 60")
+	}
+	// Duplicates are created for vertices of via ways only (edge 3 is way 30, edge 4 is way 40) and they are mapped to originals
+	duplicates := 0
+	for _, expEdge := range result {
+		if expEdge.Target <= 7 {
+			continue
+		}
+		duplicates++
+		if original, ok := graph.originals[expEdge.Target]; !ok || (original != 3 && original != 4) {
+			t.Errorf("Duplicated vertex %d should be mapped to vertex of via way, but got %d", expEdge.Target, original)
+		}
+	}
+	if duplicates == 0 {
+		t.Errorf("Vertices of via ways should be duplicated")
+	}
+}
+
+func TestViaWayRestrictionWithParts(t *testing.T) {
+	ways, _ := prepareChainedRoads()
+	// Way 30 has been cut by clipping area: its second part is not connected to other ways
+	ways = append(ways, Way{ID: 30, Direction: DirectionForward, Nodes: osm.WayNodes{{ID: 11}, {ID: 12}}})
+	coords := map[osm.NodeID]GeoPoint{
+		1: {Lon: 0, Lat: 0}, 2: {Lon: 0.001, Lat: 0}, 3: {Lon: 0.002, Lat: 0}, 4: {Lon: 0.003, Lat: 0}, 5: {Lon: 0.004, Lat: 0},
+		6: {Lon: 0.003, Lat: -0.001}, 7: {Lon: 0.002, Lat: -0.001}, 9: {Lon: 0.001, Lat: -0.001},
+		11: {Lon: 0.01, Lat: 0.01}, 12: {Lon: 0.011, Lat: 0.01},
+	}
+	edges := prepareTestEdges(ways, coords)
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "no_straight_on",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{30, "way"}},
+		To:   []restrictionComponent{{40, "way"}},
+	}})
+	if applied != 1 {
+		t.Errorf("Restriction should be applied, but got %d", applied)
+	}
+	result := graph.result()
+	fromWay10 := reachable(result, 1)
+	if fromWay10[4] || !fromWay10[7] {
+		t.Errorf("Way 10 should lead to way 70, but not to way 40 through way 30")
+	}
+}
+
+func TestNoEntryRestriction(t *testing.T) {
+	ways, edges := prepareDividedRoad()
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	// Way 10 does not pass through via node, so only way 20 is affected
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "no_entry",
+		From: []restrictionComponent{{10, "way"}, {20, "way"}},
+		Via:  []restrictionComponent{{5, "node"}},
+		To:   []restrictionComponent{{30, "way"}},
+	}})
+	if applied != 1 {
+		t.Errorf("Restriction should be applied")
+	}
+	result := graph.result()
+	// Edge 3 is 6->5, edge 6 is 5->2, edge 4 is 5->4
+	visited := reachable(result, 3)
+	if visited[6] {
+		t.Errorf("Entry to way 30 from way 20 should be prohibited")
+	}
+	if !visited[4] {
+		t.Errorf("Way 20 should be passable")
+	}
+}
+
+func TestNoUTurnRestriction(t *testing.T) {
+	ways, edges := prepareDividedRoad()
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	// U-turns on the same segment are not expanded, so there is nothing to restrict
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "no_u_turn",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{2, "node"}},
+		To:   []restrictionComponent{{10, "way"}},
+	}, {
+		ID:   2,
+		Type: "only_u_turn",
+		From: []restrictionComponent{{30, "way"}},
+		Via:  []restrictionComponent{{5, "node"}},
+		To:   []restrictionComponent{{30, "way"}},
+	}})
+	if applied != 0 {
+		t.Errorf("Restrictions should not be applied, but got %d", applied)
+	}
+	for _, result := range graph.results {
+		if result.outcome != RestrictionNotMatched || len(result.removed) != 0 {
+			t.Errorf("Restriction %d should not be matched and it should not remove turns, but got '%s' with %d removed turns", result.id, result.outcome, len(result.removed))
+		}
+	}
+	result := graph.result()
+	if len(result) != len(expandedEdges) {
+		t.Errorf("Number of expanded edges should be %d, but got %d", len(expandedEdges), len(result))
+	}
+	// Edge 1 is 1->2, edge 2 is 2->3, edge 5 is 2->5, edge 4 is 5->4
+	turns := make(map[[2]EdgeID]bool)
+	for _, expEdge := range result {
+		turns[[2]EdgeID{expEdge.Source, expEdge.Target}] = true
+	}
+	if !turns[[2]EdgeID{1, 2}] || !turns[[2]EdgeID{1, 5}] {
+		t.Errorf("Turns from way 10 at node 2 should be kept")
+	}
+	if !turns[[2]EdgeID{5, 4}] {
+		t.Errorf("Turn from way 30 to way 20 at node 5 should be kept")
+	}
+}
+
+func TestRestrictionWithoutRemovedTurns(t *testing.T) {
+	ways, edges := prepareChainedRoads()
+	expandedEdges, ids := expandTestEdges(edges)
+	graph := newTurnGraph(ways, edges, expandedEdges, ids)
+	// Way 30 is the only continuation of way 10 at node 2. Restriction 3 is the same as restriction 2, which has removed the turn already
+	applied := graph.applyRestrictions([]restriction{{
+		ID:   1,
+		Type: "only_straight_on",
+		From: []restrictionComponent{{10, "way"}},
+		Via:  []restrictionComponent{{2, "node"}},
+		To:   []restrictionComponent{{30, "way"}},
+	}, {
+		ID:   2,
+		Type: "no_right_turn",
+		From: []restrictionComponent{{30, "way"}},
+		Via:  []restrictionComponent{{3, "node"}},
+		To:   []restrictionComponent{{70, "way"}},
+	}, {
+		ID:   3,
+		Type: "no_right_turn",
+		From: []restrictionComponent{{30, "way"}},
+		Via:  []restrictionComponent{{3, "node"}},
+		To:   []restrictionComponent{{70, "way"}},
+	}})
+	if applied != 3 {
+		t.Errorf("Every restriction matches graph, so 3 applied restrictions are expected, but got %d", applied)
+	}
+	expected := map[osm.RelationID]RestrictionOutcome{1: RestrictionNoEffect, 2: RestrictionApplied, 3: RestrictionNoEffect}
+	for _, result := range graph.results {
+		if result.outcome != expected[result.id] {
+			t.Errorf("Outcome of restriction %d should be '%s', but got '%s'", result.id, expected[result.id], result.outcome)
+		}
+		if result.outcome == RestrictionNoEffect && len(result.removed) != 0 {
+			t.Errorf("Restriction %d should not remove turns, but got %d removed turns", result.id, len(result.removed))
+		}
+	}
+}
+
+func TestRestrictionTypeForMode(t *testing.T) {
+	tests := []struct {
+		tags         osm.Tags
+		mode         TransportMode
+		expectedType string
+		applicable   bool
+	}{
+		{osm.Tags{{Key: "restriction", Value: "no_left_turn"}}, TransportModeCar, "no_left_turn", true},
+		{osm.Tags{{Key: "restriction", Value: "no_left_turn"}}, TransportModeFoot, "", false},
+		{osm.Tags{{Key: "restriction", Value: "no_left_turn"}, {Key: "except", Value: "bicycle;psv"}}, TransportModeBicycle, "", false},
+		{osm.Tags{{Key: "restriction", Value: "no_left_turn"}, {Key: "except", Value: "bicycle;psv"}}, TransportModeCar, "no_left_turn", true},
+		{osm.Tags{{Key: "restriction:hgv", Value: "no_right_turn"}}, TransportModeHGV, "no_right_turn", true},
+		{osm.Tags{{Key: "restriction:hgv", Value: "no_right_turn"}}, TransportModeCar, "", false},
+		{osm.Tags{{Key: "restriction", Value: "no_left_turn"}, {Key: "restriction:hgv", Value: "only_straight_on"}}, TransportModeHGV, "only_straight_on", true},
+		{osm.Tags{{Key: "restriction:motorcar", Value: "no_u_turn"}}, TransportModeCar, "no_u_turn", true},
+	}
+	for i, test := range tests {
+		restrictionType, ok := restrictionTypeForMode(test.tags, test.mode)
+		if ok != test.applicable || restrictionType != test.expectedType {
+			t.Errorf("Test #%d: expected ('%s', %t), got ('%s', %t)", i, test.expectedType, test.applicable, restrictionType, ok)
+		}
+	}
+}
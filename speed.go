@@ -0,0 +1,186 @@
+package osm2ch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+const (
+	// fallbackSpeed is speed (km/h) for ways which have neither usable 'maxspeed' tag nor known highway class
+	fallbackSpeed = 30.0
+	mphToKmh      = 1.609344
+	knotsToKmh    = 1.852
+)
+
+// DefaultHighwaySpeeds Speeds (km/h) for highway classes. Used when way has no usable 'maxspeed' tag
+var DefaultHighwaySpeeds = map[string]float64{
+	"motorway":       110,
+	"motorway_link":  60,
+	"trunk":          90,
+	"trunk_link":     50,
+	"primary":        65,
+	"primary_link":   40,
+	"secondary":      55,
+	"secondary_link": 35,
+	"tertiary":       45,
+	"tertiary_link":  30,
+	"unclassified":   35,
+	"road":           30,
+	"residential":    25,
+	"living_street":  10,
+	"service":        15,
+	"track":          15,
+}
+
+// maxSpeedZones Implicit speed limits (km/h) which could be used as value of 'maxspeed' tag. E.g. 'RU:urban'
+// See the ref.: https://wiki.openstreetmap.org/wiki/Speed_limits#Country_code/category_conversion_table
+var maxSpeedZones = map[string]float64{
+	"at:urban":           50,
+	"at:rural":           100,
+	"at:motorway":        130,
+	"by:urban":           60,
+	"by:rural":           90,
+	"by:motorway":        110,
+	"de:urban":           50,
+	"de:rural":           100,
+	"de:living_street":   7,
+	"de:motorway":        130,
+	"fr:urban":           50,
+	"fr:rural":           80,
+	"fr:motorway":        130,
+	"gb:nsl_single":      60 * mphToKmh,
+	"gb:nsl_dual":        70 * mphToKmh,
+	"gb:motorway":        70 * mphToKmh,
+	"it:urban":           50,
+	"it:rural":           90,
+	"it:motorway":        130,
+	"kz:urban":           60,
+	"kz:rural":           90,
+	"kz:motorway":        110,
+	"pl:urban":           50,
+	"pl:rural":           90,
+	"pl:motorway":        140,
+	"ru:urban":           60,
+	"ru:rural":           90,
+	"ru:living_street":   20,
+	"ru:motorway":        110,
+	"ua:urban":           50,
+	"ua:rural":           90,
+	"ua:living_street":   20,
+	"ua:motorway":        130,
+	"us:urban":           25 * mphToKmh,
+	"us:rural":           55 * mphToKmh,
+	"us:motorway":        65 * mphToKmh,
+	"us:living_street":   15 * mphToKmh,
+	"xx:urban":           50, // Generic categories for countries which are not listed above
+	"xx:rural":           90,
+	"xx:motorway":        110,
+	"xx:living_street":   20,
+	"xx:walk":            5,
+	"xx:trunk":           90,
+	"xx:nsl_single":      90,
+	"xx:nsl_dual":        110,
+	"xx:bicycle_road":    30,
+	"xx:school_zone":     30,
+	"xx:pedestrian_zone": 10,
+}
+
+// parseMaxSpeed Parses value of 'maxspeed' tag and returns speed in km/h
+/*
+	Supported values are:
+		* plain numbers: '50' (km/h is assumed);
+		* numbers with units: '50 km/h', '30 mph', '10 knots';
+		* implicit limits: 'RU:urban', 'DE:rural', 'walk';
+		* multiple values separated by semicolon: '60;80' (the lowest one is used).
+	Values like 'none', 'signals' or 'variable' do not define any speed, so false is returned for them
+*/
+func parseMaxSpeed(value string) (float64, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, false
+	}
+	if strings.Contains(value, ";") {
+		best := 0.0
+		found := false
+		for _, part := range strings.Split(value, ";") {
+			speed, ok := parseMaxSpeed(part)
+			if !ok {
+				continue
+			}
+			if !found || speed < best {
+				best = speed
+				found = true
+			}
+		}
+		return best, found
+	}
+	switch value {
+	case "none", "signals", "variable", "implicit", "unknown":
+		return 0, false
+	case "walk":
+		return maxSpeedZones["xx:walk"], true
+	}
+	if idx := strings.Index(value, ":"); idx > 0 {
+		if speed, ok := maxSpeedZones[value]; ok {
+			return speed, true
+		}
+		// Unknown country: use generic category
+		if speed, ok := maxSpeedZones["xx"+value[idx:]]; ok {
+			return speed, true
+		}
+		return 0, false
+	}
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "mph"):
+		multiplier = mphToKmh
+		value = strings.TrimSuffix(value, "mph")
+	case strings.HasSuffix(value, "knots"):
+		multiplier = knotsToKmh
+		value = strings.TrimSuffix(value, "knots")
+	case strings.HasSuffix(value, "km/h"):
+		value = strings.TrimSuffix(value, "km/h")
+	case strings.HasSuffix(value, "kmh"):
+		value = strings.TrimSuffix(value, "kmh")
+	case strings.HasSuffix(value, "kph"):
+		value = strings.TrimSuffix(value, "kph")
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || speed <= 0 {
+		return 0, false
+	}
+	return speed * multiplier, true
+}
+
+// wayMaxSpeed Returns travel speed (km/h) along the way with given tags
+/*
+	forward - true if way is traversed in direction of its nodes, false for opposite direction.
+	Directional tags 'maxspeed:forward' / 'maxspeed:backward' take precedence over 'maxspeed'.
+	When there are no usable tags, speed is taken from the given table of speeds for highway classes
+*/
+func wayMaxSpeed(tags osm.Tags, entityName string, forward bool, highwaySpeeds map[string]float64) float64 {
+	directionalKey := "maxspeed:backward"
+	if forward {
+		directionalKey = "maxspeed:forward"
+	}
+	if speed, ok := parseMaxSpeed(tags.Find(directionalKey)); ok {
+		return speed
+	}
+	if speed, ok := parseMaxSpeed(tags.Find("maxspeed")); ok {
+		return speed
+	}
+	if speed, ok := highwaySpeeds[tags.Find(entityName)]; ok {
+		return speed
+	}
+	return fallbackSpeed
+}
+
+// travelTime Returns time (seconds) needed to pass given distance (meters) with given speed (km/h)
+func travelTime(meters, speedKmh float64) float64 {
+	if speedKmh <= 0 {
+		speedKmh = fallbackSpeed
+	}
+	return meters / (speedKmh / 3.6)
+}
@@ -0,0 +1,58 @@
+package osm2ch
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestParseMaxSpeed(t *testing.T) {
+	correctSpeeds := map[string]float64{
+		"50":       50,
+		" 60 ":     60,
+		"50 km/h":  50,
+		"30 mph":   30 * mphToKmh,
+		"30mph":    30 * mphToKmh,
+		"10 knots": 10 * knotsToKmh,
+		"RU:urban": 60,
+		"DE:rural": 100,
+		"ZZ:urban": 50,
+		"walk":     5,
+		"60;80":    60,
+	}
+	for value, correctSpeed := range correctSpeeds {
+		speed, ok := parseMaxSpeed(value)
+		if !ok {
+			t.Errorf("Value '%s' should be parsed", value)
+			continue
+		}
+		if Round(speed, 0.0005) != Round(correctSpeed, 0.0005) {
+			t.Errorf("Speed for value '%s' should be %f, but got %f", value, correctSpeed, speed)
+		}
+	}
+	for _, value := range []string{"", "none", "signals", "variable", "fast", "ZZ:unknown", "-10"} {
+		if speed, ok := parseMaxSpeed(value); ok {
+			t.Errorf("Value '%s' should not be parsed, but got %f", value, speed)
+		}
+	}
+}
+
+func TestWayMaxSpeed(t *testing.T) {
+	tags := osm.Tags{
+		{Key: "highway", Value: "primary"},
+		{Key: "maxspeed", Value: "none"},
+		{Key: "maxspeed:backward", Value: "40"},
+	}
+	forward := wayMaxSpeed(tags, "highway", true, DefaultHighwaySpeeds)
+	if forward != DefaultHighwaySpeeds["primary"] {
+		t.Errorf("Forward speed should be %f, but got %f", DefaultHighwaySpeeds["primary"], forward)
+	}
+	backward := wayMaxSpeed(tags, "highway", false, DefaultHighwaySpeeds)
+	if backward != 40 {
+		t.Errorf("Backward speed should be %f, but got %f", 40.0, backward)
+	}
+	seconds := travelTime(1000, 36)
+	if seconds != 100 {
+		t.Errorf("Travel time should be %f, but got %f", 100.0, seconds)
+	}
+}
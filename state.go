@@ -0,0 +1,245 @@
+package osm2ch
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"hash/fnv"
+	"math"
+	"os"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// State Data of previous build which is needed for applying OSM change files (see the ref. at Update)
+/*
+	State keeps every way (routable or not, since it could become routable after modification of tags only), nodes of ways,
+	restrictions, mapping of stable identifiers and fingerprints of edges (for reporting of changed edges). Every object is kept
+	in memory, so node store of configuration doesn't reduce memory consumption when state is recorded
+*/
+type State struct {
+	ways      map[osm.WayID]*osm.Way
+	nodes     map[osm.NodeID]*osm.Node
+	relations map[osm.RelationID]*osm.Relation
+	mapping   *IDMapping
+	edges     map[EdgeID]uint64
+}
+
+// stateData Persistent representation of State
+type stateData struct {
+	Ways      []stateWay
+	Nodes     []stateNode
+	Relations []stateRelation
+	Mapping   *IDMapping
+	Edges     map[EdgeID]uint64
+}
+
+// stateWay Way without metadata, node IDs only
+type stateWay struct {
+	ID    osm.WayID
+	Nodes []osm.NodeID
+	Tags  osm.Tags
+}
+
+// stateNode Node without metadata
+type stateNode struct {
+	ID   osm.NodeID
+	Lon  float64
+	Lat  float64
+	Tags osm.Tags
+}
+
+// stateMember Member of relation without metadata
+type stateMember struct {
+	Type osm.Type
+	Ref  int64
+	Role string
+}
+
+// stateRelation Relation without metadata
+type stateRelation struct {
+	ID      osm.RelationID
+	Members []stateMember
+	Tags    osm.Tags
+}
+
+// NewState Creates empty state. Pass it to import via configuration to record state of the build
+func NewState() *State {
+	return &State{
+		ways:      make(map[osm.WayID]*osm.Way),
+		nodes:     make(map[osm.NodeID]*osm.Node),
+		relations: make(map[osm.RelationID]*osm.Relation),
+		mapping:   NewIDMapping(),
+		edges:     make(map[EdgeID]uint64),
+	}
+}
+
+// LoadState Reads state from file
+func LoadState(fileName string) (*State, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open state file")
+	}
+	defer f.Close()
+	data := stateData{}
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return nil, errors.Wrap(err, "Can't decode state file")
+	}
+	state := NewState()
+	for _, way := range data.Ways {
+		nodes := make(osm.WayNodes, len(way.Nodes))
+		for i, id := range way.Nodes {
+			nodes[i] = osm.WayNode{ID: id}
+		}
+		state.ways[way.ID] = &osm.Way{ID: way.ID, Nodes: nodes, Tags: way.Tags}
+	}
+	for _, node := range data.Nodes {
+		state.nodes[node.ID] = &osm.Node{ID: node.ID, Lon: node.Lon, Lat: node.Lat, Tags: node.Tags}
+	}
+	for _, relation := range data.Relations {
+		members := make(osm.Members, len(relation.Members))
+		for i, member := range relation.Members {
+			members[i] = osm.Member{Type: member.Type, Ref: member.Ref, Role: member.Role}
+		}
+		state.relations[relation.ID] = &osm.Relation{ID: relation.ID, Members: members, Tags: relation.Tags}
+	}
+	if data.Mapping != nil {
+		state.mapping = data.Mapping
+	}
+	if data.Edges != nil {
+		state.edges = data.Edges
+	}
+	return state, nil
+}
+
+// Save Writes state to file
+func (state *State) Save(fileName string) error {
+	data := stateData{
+		Ways:      make([]stateWay, 0, len(state.ways)),
+		Nodes:     make([]stateNode, 0, len(state.nodes)),
+		Relations: make([]stateRelation, 0, len(state.relations)),
+		Mapping:   state.mapping,
+		Edges:     state.edges,
+	}
+	for _, way := range state.ways {
+		nodes := make([]osm.NodeID, len(way.Nodes))
+		for i, node := range way.Nodes {
+			nodes[i] = node.ID
+		}
+		data.Ways = append(data.Ways, stateWay{ID: way.ID, Nodes: nodes, Tags: way.Tags})
+	}
+	for _, node := range state.nodes {
+		data.Nodes = append(data.Nodes, stateNode{ID: node.ID, Lon: node.Lon, Lat: node.Lat, Tags: node.Tags})
+	}
+	for _, relation := range state.relations {
+		members := make([]stateMember, len(relation.Members))
+		for i, member := range relation.Members {
+			members[i] = stateMember{Type: member.Type, Ref: member.Ref, Role: member.Role}
+		}
+		data.Relations = append(data.Relations, stateRelation{ID: relation.ID, Members: members, Tags: relation.Tags})
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, "Can't create state file")
+	}
+	if err := gob.NewEncoder(f).Encode(&data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "Can't encode state file")
+	}
+	return errors.Wrap(f.Close(), "Can't close state file")
+}
+
+// IDMapping Returns mapping of stable identifiers which is kept in state
+func (state *State) IDMapping() *IDMapping {
+	return state.mapping
+}
+
+// configure Returns copy of configuration which uses mapping of state for stable identifiers.
+// If configuration has its own mapping then state adopts it
+func (state *State) configure(cfg *OsmConfiguration) *OsmConfiguration {
+	stateCfg := *cfg
+	stateCfg.State = state
+	if stateCfg.IDMapping != nil {
+		state.mapping = stateCfg.IDMapping
+	} else {
+		stateCfg.IDMapping = state.mapping
+	}
+	return &stateCfg
+}
+
+// clearObjects Forgets OSM objects of previous build. Mapping of identifiers is kept
+func (state *State) clearObjects() {
+	state.ways = make(map[osm.WayID]*osm.Way)
+	state.nodes = make(map[osm.NodeID]*osm.Node)
+	state.relations = make(map[osm.RelationID]*osm.Relation)
+}
+
+// putWay Keeps way (without metadata) in state
+func (state *State) putWay(way *osm.Way) {
+	nodes := make(osm.WayNodes, len(way.Nodes))
+	for i, node := range way.Nodes {
+		nodes[i] = osm.WayNode{ID: node.ID}
+	}
+	tags := make(osm.Tags, len(way.Tags))
+	copy(tags, way.Tags)
+	state.ways[way.ID] = &osm.Way{ID: way.ID, Nodes: nodes, Tags: tags}
+}
+
+// deleteWay Forgets way
+func (state *State) deleteWay(id osm.WayID) {
+	delete(state.ways, id)
+}
+
+// deleteRelation Forgets relation
+func (state *State) deleteRelation(id osm.RelationID) {
+	delete(state.relations, id)
+}
+
+// putNode Keeps node (without metadata) in state
+func (state *State) putNode(node *osm.Node) {
+	var tags osm.Tags
+	if len(node.Tags) != 0 {
+		tags = make(osm.Tags, len(node.Tags))
+		copy(tags, node.Tags)
+	}
+	state.nodes[node.ID] = &osm.Node{ID: node.ID, Lon: node.Lon, Lat: node.Lat, Tags: tags}
+}
+
+// putRelation Keeps relation (without metadata) in state
+func (state *State) putRelation(relation *osm.Relation) {
+	members := make(osm.Members, len(relation.Members))
+	for i, member := range relation.Members {
+		members[i] = osm.Member{Type: member.Type, Ref: member.Ref, Role: member.Role}
+	}
+	tags := make(osm.Tags, len(relation.Tags))
+	copy(tags, relation.Tags)
+	state.relations[relation.ID] = &osm.Relation{ID: relation.ID, Members: members, Tags: tags}
+}
+
+// recordEdges Keeps fingerprints of edges of built graph
+func (state *State) recordEdges(edges []Edge) {
+	state.edges = make(map[EdgeID]uint64, len(edges))
+	for i := range edges {
+		state.edges[edges[i].ID] = edges[i].fingerprint()
+	}
+}
+
+// fingerprint Returns hash of edge's geometry and costs. It is used for detecting of changed edges
+func (edge *Edge) fingerprint() uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	write := func(v float64) {
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+		h.Write(buf)
+	}
+	write(edge.CostMeters)
+	write(edge.CostSeconds)
+	for _, pt := range edge.Geom {
+		write(pt.Lon)
+		write(pt.Lat)
+	}
+	if edge.WasOneway {
+		h.Write([]byte{1})
+	}
+	return h.Sum64()
+}
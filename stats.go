@@ -0,0 +1,104 @@
+package osm2ch
+
+import (
+	"sort"
+
+	"github.com/paulmach/osm"
+)
+
+// ImportStats Counters which describe quality of OSM data and results of import
+/*
+	Counters could be compared between builds (e.g. for alerting on regressions of data quality).
+	Counters of edge expanded graph (cycles, restrictions which have been applied and expanded edges) are zero for GraphModeNode
+*/
+type ImportStats struct {
+	// Ways which have been accepted by configuration
+	Ways int `json:"ways"`
+	// Ways which are left after clipping by ClipArea of configuration (equals to Ways when clipping is not used)
+	WaysAfterClipping int `json:"ways_after_clipping"`
+	// Nodes which are referenced by accepted ways
+	Nodes int `json:"nodes"`
+	// Nodes which have become vertices of node based graph (ends of ways, intersections, barriers and etc.)
+	Vertices int `json:"vertices"`
+	// Edges which have been produced from oneway roads
+	OnewayEdges int `json:"oneway_edges"`
+	// Edges which have been produced from two-way roads (both directions are counted)
+	NotOnewayEdges int `json:"not_oneway_edges"`
+	// Edges of resulting graph
+	Edges int `json:"edges"`
+	// Turns which have been ignored during edge expanding since source and target of turn are the same edge
+	IgnoredCycles int `json:"ignored_cycles"`
+	// Expanded edges of resulting graph (after applying of restrictions)
+	ExpandedEdges int `json:"expanded_edges"`
+	// Restrictions which are relevant for profile and have supported set of members
+	Restrictions int `json:"restrictions"`
+	// Restrictions which are relevant for profile, but have unsupported set of members
+	SkippedRestrictions int `json:"skipped_restrictions"`
+	// Members of restrictions with unknown roles (only 'from', 'to' and 'via' are supported)
+	UnsupportedRestrictionRoles int `json:"unsupported_restriction_roles"`
+	// Restrictions which have been applied to edge expanded graph (including ones which match graph, but don't remove any turn)
+	AppliedRestrictions int `json:"applied_restrictions"`
+	// Combinations of types of members ('from;to;via', e.g. 'way;way;node') which have been met for every type of restriction
+	// (including restrictions with unsupported set of members)
+	RestrictionCombos map[string][]string `json:"restriction_combos"`
+}
+
+// newImportStats Creates empty statistics
+func newImportStats() *ImportStats {
+	return &ImportStats{
+		RestrictionCombos: make(map[string][]string),
+	}
+}
+
+// addRestriction Counts relation of restriction with given type.
+// Number of members with unknown roles and outcome are expected as they are returned by parseRestriction
+/*
+	Combination of types of members is recorded for every relation, including ones with unsupported set of members
+*/
+func (stats *ImportStats) addRestriction(tag string, r *restriction, unsupportedRoles int, outcome RestrictionOutcome) {
+	stats.UnsupportedRestrictionRoles += unsupportedRoles
+	stats.addRestrictionCombo(tag, r.combo())
+	if outcome != RestrictionPending {
+		stats.SkippedRestrictions++
+	}
+}
+
+// addRestrictionCombo Records combination of types of members for given type of restriction. Combinations are kept sorted
+func (stats *ImportStats) addRestrictionCombo(tag, combo string) {
+	combos := stats.RestrictionCombos[tag]
+	idx := sort.SearchStrings(combos, combo)
+	if idx < len(combos) && combos[idx] == combo {
+		return
+	}
+	combos = append(combos, "")
+	copy(combos[idx+1:], combos[idx:])
+	combos[idx] = combo
+	stats.RestrictionCombos[tag] = combos
+}
+
+// countedRestriction Arguments of addRestriction which are kept until relations are deduplicated
+type countedRestriction struct {
+	tag              string
+	restriction      restriction
+	unsupportedRoles int
+	outcome          RestrictionOutcome
+}
+
+// restrictionCounts Restriction relations by their IDs which should be counted in statistics. Newer version of relation
+// replaces older one, so relations which are met in several sources (e.g. overlapping extracts) are counted once
+type restrictionCounts map[osm.RelationID]countedRestriction
+
+// addRestrictions Counts relations of restrictions (in order of their IDs)
+func (stats *ImportStats) addRestrictions(counts restrictionCounts) {
+	ids := make([]osm.RelationID, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		counted := counts[id]
+		stats.addRestriction(counted.tag, &counted.restriction, counted.unsupportedRoles, counted.outcome)
+	}
+}
@@ -0,0 +1,81 @@
+package osm2ch
+
+import (
+	"math"
+)
+
+const (
+	// Turns with smaller angle (degrees) are considered as going straight
+	straightAngle = 30.0
+	// Turns with bigger angle are considered as sharp turns
+	sharpAngle = 120.0
+	// Turns with bigger angle are considered as U-turns
+	uTurnAngle = 170.0
+)
+
+// TurnCosts Time penalties (seconds) for turns depending on turn angle. Going straight is free
+/*
+	Turn angle is evaluated between the last segment of incoming edge and the first segment of outcoming edge:
+		* less than 30 degrees - going straight;
+		* 30-120 degrees - left or right turn;
+		* 120-170 degrees - sharp left or sharp right turn;
+		* more than 170 degrees - U-turn.
+	Costs are given for right-hand traffic: left turns are crossing opposite traffic. For left-hand traffic countries (UK, Japan and etc.)
+	set LeftHandTraffic so left and right costs are swapped
+*/
+type TurnCosts struct {
+	Left            float64 `json:"left" yaml:"left"`
+	Right           float64 `json:"right" yaml:"right"`
+	SharpLeft       float64 `json:"sharp_left" yaml:"sharp_left"`
+	SharpRight      float64 `json:"sharp_right" yaml:"sharp_right"`
+	UTurn           float64 `json:"u_turn" yaml:"u_turn"`
+	LeftHandTraffic bool    `json:"left_hand_traffic" yaml:"left_hand_traffic"`
+}
+
+// Cost Returns time penalty (seconds) for turn with given angle (degrees, positive values are right turns)
+func (costs TurnCosts) Cost(angle float64) float64 {
+	if costs.LeftHandTraffic {
+		angle = -angle
+	}
+	absAngle := math.Abs(angle)
+	switch {
+	case absAngle < straightAngle:
+		return 0
+	case absAngle >= uTurnAngle:
+		return costs.UTurn
+	case absAngle >= sharpAngle:
+		if angle > 0 {
+			return costs.SharpRight
+		}
+		return costs.SharpLeft
+	default:
+		if angle > 0 {
+			return costs.Right
+		}
+		return costs.Left
+	}
+}
+
+// turnAngle Returns angle (degrees in range (-180; 180]) between the last segment of incoming line and the first segment of outcoming line.
+// Positive values are right turns, negative values are left turns. Returns zero if any of lines is degenerate
+func turnAngle(from, to []GeoPoint) float64 {
+	// Skip duplicated points, since they don't give direction
+	i := len(from) - 1
+	for i > 0 && from[i-1] == from[len(from)-1] {
+		i--
+	}
+	j := 0
+	for j < len(to)-1 && to[j+1] == to[0] {
+		j++
+	}
+	if i == 0 || j == len(to)-1 || len(from) < 2 || len(to) < 2 {
+		return 0
+	}
+	incoming := bearing(from[i-1], from[len(from)-1])
+	outcoming := bearing(to[0], to[j+1])
+	angle := math.Mod(outcoming-incoming+360.0, 360.0)
+	if angle > 180.0 {
+		angle -= 360.0
+	}
+	return angle
+}
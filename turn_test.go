@@ -0,0 +1,53 @@
+package osm2ch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTurnCosts(t *testing.T) {
+	_, edges := prepareDividedRoad()
+	costs := TurnCosts{Left: 10, Right: 3, SharpLeft: 15, SharpRight: 8, UTurn: 30}
+	cfg := &OsmConfiguration{TurnPenalty: 1, TurnCosts: costs}
+	expandedEdges, _ := expandEdges(edges, nil, cfg)
+	// Edge 1 is 1->2 (heading east), edge 5 is 2->5 (heading south), edge 2 is 2->3 (heading east), edge 6 is 5->2 (heading north)
+	expected := map[[2]EdgeID]struct {
+		angle float64
+		cost  float64
+	}{
+		{1, 5}: {90, 3 + 1},
+		{1, 2}: {0, 0},
+		{6, 2}: {90, 3 + 1},
+		{3, 6}: {90, 3 + 1},
+	}
+	for _, expEdge := range expandedEdges {
+		exp, ok := expected[[2]EdgeID{expEdge.Source, expEdge.Target}]
+		if !ok {
+			continue
+		}
+		if math.Abs(expEdge.TurnAngle-exp.angle) > 0.5 {
+			t.Errorf("Turn %d->%d: angle should be %f, got %f", expEdge.Source, expEdge.Target, exp.angle, expEdge.TurnAngle)
+		}
+		if expEdge.TurnCostSeconds != exp.cost {
+			t.Errorf("Turn %d->%d: cost should be %f, got %f", expEdge.Source, expEdge.Target, exp.cost, expEdge.TurnCostSeconds)
+		}
+	}
+
+	costs.LeftHandTraffic = true
+	tests := []struct {
+		angle    float64
+		expected float64
+	}{
+		{10, 0},
+		{90, 10},
+		{-90, 3},
+		{150, 15},
+		{-150, 8},
+		{180, 30},
+	}
+	for _, test := range tests {
+		if got := costs.Cost(test.angle); got != test.expected {
+			t.Errorf("Left-hand traffic, angle %f: cost should be %f, got %f", test.angle, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package osm2ch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/paulmach/osm"
+	"github.com/pkg/errors"
+)
+
+// ChangeReport Describes how graph has been changed by OSM change file
+type ChangeReport struct {
+	// Edges (vertices of edge expanded graph) which did not exist in previous build
+	AddedEdges []EdgeID
+	// Edges of previous build which do not exist anymore
+	RemovedEdges []EdgeID
+	// Edges which have kept identifiers, but their geometry or costs have been changed
+	ChangedEdges []EdgeID
+	// Routable ways which have been skipped since some of their nodes are missing in both state and change file
+	// (e.g. way refers to node which is not part of any way and which has not been changed)
+	SkippedWays []osm.WayID
+}
+
+// UpdateFromOSCFile Applies OSM change file (*.osc or gzip compressed *.osc.gz) to state of previous build and imports updated graph
+/*
+	See the ref. at Update
+*/
+func UpdateFromOSCFile(fileName string, state *State, cfg *OsmConfiguration) (*Graph, *ChangeReport, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "File open")
+	}
+	defer f.Close()
+	return Update(context.Background(), f, state, cfg)
+}
+
+// Update Applies OSM change (osmChange XML, optionally gzip compressed) to state of previous build and imports updated graph
+/*
+	State is recorded by import (see the ref. at State field of OsmConfiguration) or by previous update and it is modified in place,
+	so it should be saved after update for applying of the next change file. Configuration should be the same as for the original build.
+	Stable identifiers are used: untouched segments keep their identifiers. Report lists edges which have been added, removed or changed.
+	Created or modified ways are included into graph only if they are accepted by configuration and every their node is known
+	(either from state or from change file). State keeps nodes of every way, so ways which become routable by modification
+	of tags only or which are connected to nodes of other ways are included too. Ways which have been skipped are listed in report
+*/
+func Update(ctx context.Context, r io.Reader, state *State, cfg *OsmConfiguration) (*Graph, *ChangeReport, error) {
+	cfg = state.configure(cfg)
+	profile := cfg.profile()
+	logger := cfg.logger()
+
+	stage := startStage(logger, "changes")
+	change, err := readChange(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkCancelled(ctx, "changes"); err != nil {
+		return nil, nil, err
+	}
+	created, modified, deleted := state.applyChange(change, cfg, profile)
+	stage.finish(Counter{"created", created}, Counter{"modified", modified}, Counter{"deleted", deleted})
+
+	stage = startStage(logger, "preparing")
+	report := &ChangeReport{}
+	stats := newImportStats()
+	wayIDs := make([]osm.WayID, 0, len(state.ways))
+	for id := range state.ways {
+		wayIDs = append(wayIDs, id)
+	}
+	sort.Slice(wayIDs, func(i, j int) bool {
+		return wayIDs[i] < wayIDs[j]
+	})
+	ways := make([]Way, 0, len(wayIDs))
+	referencedNodes := []osm.NodeID{}
+	for _, id := range wayIDs {
+		way := state.ways[id]
+		preparedWay, ok := cfg.prepareWay(way, profile)
+		if !ok {
+			continue
+		}
+		complete := true
+		for _, node := range way.Nodes {
+			if _, ok := state.nodes[node.ID]; !ok {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			report.SkippedWays = append(report.SkippedWays, id)
+			continue
+		}
+		ways = append(ways, preparedWay)
+		for _, node := range way.Nodes {
+			referencedNodes = append(referencedNodes, node.ID)
+		}
+	}
+	state.pruneNodes()
+
+	refs := newNodeRefs(referencedNodes)
+	nodes, err := cfg.nodeStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer nodes.Close()
+	nodeCosts := make(map[osm.NodeID]nodeCost)
+	for i, id := range refs.ids {
+		node := state.nodes[id]
+		refs.found[i] = true
+		if err := nodes.Put(id, GeoPoint{Lon: node.Lon, Lat: node.Lat}); err != nil {
+			return nil, nil, err
+		}
+		if cost := cfg.nodeCost(node.Tags, profile); cost.significant() {
+			nodeCosts[id] = cost
+		}
+	}
+	if err := nodes.Seal(); err != nil {
+		return nil, nil, err
+	}
+
+	relationIDs := make([]osm.RelationID, 0, len(state.relations))
+	for id := range state.relations {
+		relationIDs = append(relationIDs, id)
+	}
+	sort.Slice(relationIDs, func(i, j int) bool {
+		return relationIDs[i] < relationIDs[j]
+	})
+	restrictions := []restriction{}
+	diagnostics := cfg.restrictionDiagnostics()
+	for _, id := range relationIDs {
+		relation := state.relations[id]
+		tag, ok := restrictionTypeForMode(cfg.resolveTags(relation.Tags), profile.Mode())
+		if !ok {
+			continue
+		}
+		r, unsupportedRoles, outcome := parseRestriction(relation, tag)
+		stats.addRestriction(tag, &r, unsupportedRoles, outcome)
+		diagnostics.add(relation, tag, outcome)
+		if outcome == RestrictionPending {
+			restrictions = append(restrictions, r)
+		}
+	}
+	stats.Ways, stats.Nodes, stats.Restrictions = len(ways), len(refs.ids), len(restrictions)
+	// Ways are skipped because of missing nodes
+	stage.finish(
+		Counter{"ways", len(ways)},
+		Counter{"skipped_ways", len(report.SkippedWays)},
+		Counter{"nodes", len(refs.ids)},
+		Counter{"restrictions", len(restrictions)},
+	)
+
+	previousEdges := state.edges
+	graph, err := buildGraph(ctx, cfg, profile, ways, refs, nodes, nodeCosts, restrictions, stats, diagnostics)
+	if err != nil {
+		return nil, nil, err
+	}
+	stage = startStage(logger, "comparing")
+	state.recordEdges(graph.Edges)
+	report.compareEdges(previousEdges, state.edges)
+	stage.finish(Counter{"added_edges", len(report.AddedEdges)}, Counter{"removed_edges", len(report.RemovedEdges)}, Counter{"changed_edges", len(report.ChangedEdges)})
+	return graph, report, nil
+}
+
+// readChange Decodes osmChange XML. Gzip compressed data is detected by magic bytes
+func readChange(r io.Reader) (*osm.Change, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "Can't read change file")
+	}
+	var source io.Reader = br
+	if bytes.Equal(head, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, &ParseError{Stage: "changes", Err: errors.Wrap(err, "Can't read gzip compressed change file")}
+		}
+		defer gz.Close()
+		source = gz
+	}
+	change := &osm.Change{}
+	if err := xml.NewDecoder(source).Decode(change); err != nil {
+		return nil, &ParseError{Stage: "changes", Err: errors.Wrap(err, "Can't decode change file")}
+	}
+	return change, nil
+}
+
+// applyChange Applies created, modified and deleted objects to state. Returns number of objects which have been taken into account
+/*
+	Ways and nodes are kept always (nodes which are not used by ways are pruned after ways are prepared), so modified way
+	could join or leave the graph. Relations are kept only if they are accepted by configuration
+*/
+func (state *State) applyChange(change *osm.Change, cfg *OsmConfiguration, profile Profile) (int, int, int) {
+	apply := func(data *osm.OSM) int {
+		if data == nil {
+			return 0
+		}
+		for _, node := range data.Nodes {
+			state.putNode(node)
+		}
+		for _, way := range data.Ways {
+			state.putWay(way)
+		}
+		for _, relation := range data.Relations {
+			if _, ok := restrictionTypeForMode(cfg.resolveTags(relation.Tags), profile.Mode()); ok {
+				state.putRelation(relation)
+			} else {
+				state.deleteRelation(relation.ID)
+			}
+		}
+		return len(data.Nodes) + len(data.Ways) + len(data.Relations)
+	}
+	created := apply(change.Create)
+	modified := apply(change.Modify)
+	deleted := 0
+	if change.Delete != nil {
+		for _, node := range change.Delete.Nodes {
+			delete(state.nodes, node.ID)
+		}
+		for _, way := range change.Delete.Ways {
+			state.deleteWay(way.ID)
+		}
+		for _, relation := range change.Delete.Relations {
+			state.deleteRelation(relation.ID)
+		}
+		deleted = len(change.Delete.Nodes) + len(change.Delete.Ways) + len(change.Delete.Relations)
+	}
+	return created, modified, deleted
+}
+
+// pruneNodes Removes nodes which are not referenced by ways of state
+func (state *State) pruneNodes() {
+	used := make(map[osm.NodeID]bool, len(state.nodes))
+	for _, way := range state.ways {
+		for _, node := range way.Nodes {
+			used[node.ID] = true
+		}
+	}
+	for id := range state.nodes {
+		if !used[id] {
+			delete(state.nodes, id)
+		}
+	}
+}
+
+// compareEdges Fills report by comparing fingerprints of edges of previous and current builds
+func (report *ChangeReport) compareEdges(previous, current map[EdgeID]uint64) {
+	for id, fingerprint := range current {
+		previousFingerprint, ok := previous[id]
+		if !ok {
+			report.AddedEdges = append(report.AddedEdges, id)
+		} else if previousFingerprint != fingerprint {
+			report.ChangedEdges = append(report.ChangedEdges, id)
+		}
+	}
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			report.RemovedEdges = append(report.RemovedEdges, id)
+		}
+	}
+	for _, ids := range [][]EdgeID{report.AddedEdges, report.RemovedEdges, report.ChangedEdges} {
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+	}
+}
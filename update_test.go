@@ -0,0 +1,89 @@
+package osm2ch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	changes, err := ioutil.ReadFile("testdata/crossroad.osc")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	compressed := bytes.Buffer{}
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(changes)
+	gz.Close()
+
+	for _, data := range [][]byte{changes, compressed.Bytes()} {
+		state := NewState()
+		original, err := ImportGraphFromOSMFile("testdata/crossroad.osm", &OsmConfiguration{State: state})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		updated, report, err := Update(context.Background(), bytes.NewReader(data), state, &OsmConfiguration{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(report.AddedEdges) != 2 || len(report.RemovedEdges) != 2 || len(report.ChangedEdges) != 2 {
+			t.Errorf("2 added, 2 removed and 2 changed edges are expected, but got %d, %d and %d", len(report.AddedEdges), len(report.RemovedEdges), len(report.ChangedEdges))
+		}
+		// Edges of untouched ways should keep their identifiers
+		originalIDs := map[SegmentKey]EdgeID{}
+		for _, edge := range original.Edges {
+			originalIDs[edge.segmentKey()] = edge.ID
+		}
+		for _, edge := range updated.Edges {
+			if edge.WayID != 101 && edge.WayID != 102 {
+				continue
+			}
+			if edge.ID != originalIDs[edge.segmentKey()] {
+				t.Errorf("Edge %v should keep identifier %d, but got %d", edge.segmentKey(), originalIDs[edge.segmentKey()], edge.ID)
+			}
+		}
+		// Restriction has been deleted
+		turnFound := false
+		for _, expEdge := range updated.ExpandedEdges {
+			if expEdge.SourceOSMWayID == 101 && expEdge.TargetOSMWayID == 201 {
+				turnFound = true
+			}
+		}
+		if !turnFound {
+			t.Errorf("Turn from way 101 to way 201 should be allowed after update")
+		}
+	}
+}
+
+func TestUpdateWayBecomesRoutable(t *testing.T) {
+	state := NewState()
+	_, err := ImportGraphFromOSMFile("testdata/crossroad_construction.osm", &OsmConfiguration{State: state})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// Way 203 becomes routable by modification of tags only, new way 204 is connected to node of building
+	updated, report, err := UpdateFromOSCFile("testdata/construction.osc", state, &OsmConfiguration{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(report.SkippedWays) != 0 {
+		t.Errorf("No skipped ways are expected, but got %v", report.SkippedWays)
+	}
+	if len(report.AddedEdges) != 4 {
+		t.Errorf("4 added edges are expected, but got %d", len(report.AddedEdges))
+	}
+	found := map[int64]bool{}
+	for _, edge := range updated.Edges {
+		found[int64(edge.WayID)] = true
+	}
+	if !found[203] || !found[204] {
+		t.Errorf("Edges of ways 203 and 204 should be included into graph after update")
+	}
+}
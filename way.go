@@ -1,12 +1,87 @@
 package osm2ch
 
 import (
+	"fmt"
+
 	"github.com/paulmach/osm"
 )
 
 type Way struct {
-	ID     osm.WayID
-	Oneway bool
-	Nodes  osm.WayNodes
-	TagMap osm.Tags
+	ID        osm.WayID
+	Direction Direction
+	Nodes     osm.WayNodes
+	TagMap    osm.Tags
+	// Multiplier for travel time caused by access restrictions
+	accessPenalty float64
+}
+
+// Direction Allowed directions of travelling along the way (with respect to order of way's nodes)
+type Direction uint16
+
+const (
+	DirectionBoth = Direction(iota)
+	DirectionForward
+	DirectionBackward
+	// Way can't be used in any direction. E.g. 'oneway=reversible' since direction depends on time
+	DirectionNone
+)
+
+// String returns pretty printed value for Direction
+func (direction Direction) String() string {
+	switch direction {
+	case DirectionBoth:
+		return "both"
+	case DirectionForward:
+		return "forward"
+	case DirectionBackward:
+		return "backward"
+	case DirectionNone:
+		return "none"
+	default:
+		return fmt.Sprintf("unknown(%d)", direction)
+	}
+}
+
+// Forward Checks if travelling in direction of way's nodes is allowed
+func (direction Direction) Forward() bool {
+	return direction == DirectionBoth || direction == DirectionForward
+}
+
+// Backward Checks if travelling in direction opposite to way's nodes is allowed
+func (direction Direction) Backward() bool {
+	return direction == DirectionBoth || direction == DirectionBackward
+}
+
+// Oneway Checks if travelling is allowed in single direction only
+func (direction Direction) Oneway() bool {
+	return direction == DirectionForward || direction == DirectionBackward
+}
+
+// prepareWay Filters OSM way by configuration and profile. Returns false if way should not be included into graph
+func (cfg *OsmConfiguration) prepareWay(way *osm.Way, profile Profile) (Way, bool) {
+	tags := cfg.resolveTags(way.Tags)
+	if len(cfg.Tags) != 0 && !cfg.CheckTag(tags.Find(cfg.EntityName)) {
+		return Way{}, false
+	}
+	if !profile.Accept(tags) {
+		return Way{}, false
+	}
+	accessPenalty, ok := cfg.wayAccess(tags, profile.Mode())
+	if !ok {
+		return Way{}, false
+	}
+	direction := profile.Direction(tags)
+	if direction == DirectionNone {
+		return Way{}, false
+	}
+	preparedWay := Way{
+		ID:            way.ID,
+		Nodes:         make(osm.WayNodes, len(way.Nodes)),
+		Direction:     direction,
+		TagMap:        make(osm.Tags, len(tags)),
+		accessPenalty: accessPenalty,
+	}
+	copy(preparedWay.Nodes, way.Nodes)
+	copy(preparedWay.TagMap, tags)
+	return preparedWay, true
 }